@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// writeBatchResults sends the per-item results of a batch. A rolled back
+// all-or-nothing batch is sent as 422 so clients notice nothing was saved.
+func (a *applicationDependencies) writeBatchResults(w http.ResponseWriter, r *http.Request, results []*data.BatchResult, committed bool) {
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusUnprocessableEntity
+	}
+
+	data := envelope{
+		"results":   results,
+		"committed": committed,
+	}
+	err := a.writeJSON(w, status, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// add and remove many books of a reading list at once
+func (a *applicationDependencies) batchReadingListBooksHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := a.readIDParam(r, "list_id")
+	if err != nil || listID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Add          []int64 `json:"add"`
+		Remove       []int64 `json:"remove"`
+		AllOrNothing bool    `json:"all_or_nothing"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateBatchSize(v, len(incomingData.Add)+len(incomingData.Remove))
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = a.readingListModel.Get(listID, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	results, committed, err := a.readingListBookModel.Batch(listID, incomingData.Add, incomingData.Remove, incomingData.AllOrNothing)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeBatchResults(w, r, results, committed)
+}
+
+// move many books to the trash and update many books at once
+func (a *applicationDependencies) batchBooksHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Delete []int64 `json:"delete"`
+		Update []struct {
+			ID              int64   `json:"id"`
+			Title           *string `json:"title"`
+			ISBN            *string `json:"isbn"`
+			PublicationDate *string `json:"publication_date"`
+			Description     *string `json:"description"`
+			Version         *int32  `json:"version"`
+		} `json:"update"`
+		AllOrNothing bool `json:"all_or_nothing"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateBatchSize(v, len(incomingData.Delete)+len(incomingData.Update))
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var items []*data.BookBatchItem
+	for _, id := range incomingData.Delete {
+		items = append(items, &data.BookBatchItem{ID: id, Action: data.BatchDelete})
+	}
+
+	for _, update := range incomingData.Update {
+		patch := &data.BookPatch{
+			Title:       update.Title,
+			ISBN:        update.ISBN,
+			Description: update.Description,
+			Version:     update.Version,
+		}
+
+		v := validator.New()
+		if update.PublicationDate != nil {
+			publicationDate, err := time.Parse("2006-01-02", *update.PublicationDate)
+			if err != nil {
+				v.AddError("publication_date", "must be a date in YYYY-MM-DD format")
+			} else {
+				patch.PublicationDate = &publicationDate
+			}
+		}
+		data.ValidateBookPatch(v, patch)
+		items = append(items, &data.BookBatchItem{ID: update.ID, Action: data.BatchUpdate, Patch: patch, Errors: v.Errors})
+	}
+
+	user := a.contextGetUser(r)
+	results, committed, err := a.bookModel.Batch(items, incomingData.AllOrNothing, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeBatchResults(w, r, results, committed)
+}
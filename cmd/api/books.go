@@ -1,8 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/data"
@@ -10,14 +14,124 @@ import (
 )
 
 type bookResponse struct {
-	Title           string    `json:"title"`
-	Authors         []string  `json:"authors"`
-	ISBN            string    `json:"isbn"`
-	PublicationDate time.Time `json:"publication_date"`
-	Genre           string    `json:"genre"`
-	Description     string    `json:"description"`
-	AverageRating   float64   `json:"average_rating"`
-	Version         int32     `json:"version"`
+	ID              int64               `json:"id"`
+	Title           string              `json:"title"`
+	Authors         []string            `json:"authors"`
+	ISBN            string              `json:"isbn"`
+	PublicationDate time.Time           `json:"publication_date"`
+	Genre           string              `json:"genre"`
+	Genres          []string            `json:"genres"`
+	Description     string              `json:"description"`
+	AverageRating   float64             `json:"average_rating"`
+	CoverURL        string              `json:"cover_url,omitempty"`
+	Series          *bookSeriesResponse `json:"series,omitempty"`
+	Included        map[string]any      `json:"included,omitempty"`
+	Version         int32               `json:"version"`
+}
+
+// the fields a book response can be restricted to with fields=
+var bookResponseFields = []string{"id", "title", "authors", "isbn", "publication_date", "genre", "genres", "description",
+	"average_rating", "cover_url", "series", "included", "version"}
+
+type bookSeriesResponse struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Position *float64 `json:"position"`
+}
+
+// bookSeries returns the series part of a book response, nil for books
+// that are not in a series
+func bookSeries(book *data.Book) *bookSeriesResponse {
+	if book.SeriesID == nil {
+		return nil
+	}
+	return &bookSeriesResponse{ID: *book.SeriesID, Name: book.SeriesName, Position: book.SeriesPosition}
+}
+
+// setBookSeries puts a book in a series at the position. A series ID of 0
+// takes the book out of its series, a nil ID keeps the current series and
+// only moves the book to the new position. A book moved to another series
+// loses its old position unless a new one is given. Problems are reported
+// on the validator.
+func (a *applicationDependencies) setBookSeries(v *validator.Validator, book *data.Book, seriesID *int64, position *float64) error {
+	if seriesID != nil {
+		if *seriesID == 0 {
+			book.SeriesID = nil
+			book.SeriesName = ""
+			book.SeriesPosition = nil
+		} else {
+			series, err := a.seriesModel.Get(*seriesID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					v.AddError("series_id", "must be an existing series")
+					return nil
+				default:
+					return err
+				}
+			}
+			if book.SeriesID == nil || *book.SeriesID != series.ID {
+				book.SeriesPosition = nil
+			}
+			book.SeriesID = &series.ID
+			book.SeriesName = series.Name
+		}
+	}
+
+	if position != nil {
+		data.ValidateSeriesPosition(v, *position)
+		v.Check(book.SeriesID != nil, "series_position", "can only be set for a book in a series")
+		book.SeriesPosition = position
+	}
+	return nil
+}
+
+// resolveGenres looks up genres by their name or slug, keeping the order
+// they were given in. Unknown genres are reported on the validator.
+func (a *applicationDependencies) resolveGenres(v *validator.Validator, names []string) ([]*data.Genre, error) {
+	var slugs []string
+	for _, name := range names {
+		slug := data.GenreSlug(name)
+		if slug != "" && !validator.PermittedValue(slug, slugs...) {
+			slugs = append(slugs, slug)
+		}
+	}
+	if len(slugs) == 0 {
+		return nil, nil
+	}
+
+	found, err := a.genreModel.GetBySlugs(slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	bySlug := make(map[string]*data.Genre, len(found))
+	for _, genre := range found {
+		bySlug[genre.Slug] = genre
+	}
+
+	genres := make([]*data.Genre, 0, len(slugs))
+	for _, slug := range slugs {
+		genre, ok := bySlug[slug]
+		if !ok {
+			v.AddError("genres", fmt.Sprintf("unknown genre %q, see /v1/genres for the available genres", slug))
+			continue
+		}
+		genres = append(genres, genre)
+	}
+
+	return genres, nil
+}
+
+// genreIDsAndNames splits genres into their IDs and names
+func genreIDsAndNames(genres []*data.Genre) ([]int64, []string) {
+	ids := make([]int64, len(genres))
+	names := make([]string, len(genres))
+	for i, genre := range genres {
+		ids[i] = genre.ID
+		names[i] = genre.Name
+	}
+	return ids, names
 }
 
 // create a book handler
@@ -30,7 +144,10 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		ISBN            string   `json:"isbn"`
 		PublicationDate string   `json:"publication_date"`
 		Genre           string   `json:"genre"`
+		Genres          []string `json:"genres"`
 		Description     string   `json:"description"`
+		SeriesID        *int64   `json:"series_id"`
+		SeriesPosition  *float64 `json:"series_position"`
 	}
 
 	// decode the incoming JSON
@@ -65,44 +182,75 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 
 	v := validator.New()
 
+	// the primary genre comes first, followed by any additional genres
+	genres, err := a.resolveGenres(v, append([]string{incomingData.Genre}, incomingData.Genres...))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if len(genres) > 0 {
+		book.Genre = genres[0].Name
+	}
+
+	err = a.setBookSeries(v, book, incomingData.SeriesID, incomingData.SeriesPosition)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	data.ValidateBook(v, book)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// the book, its genres, its authors and its first revision are saved
+	// together
+	tx, err := a.bookModel.Begin()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
 	// insert the book into the database
-	err = a.bookModel.Insert(book)
+	err = tx.Insert(book)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	genreIDs, genreNames := genreIDsAndNames(genres)
+	err = tx.SetGenres(book.ID, genreIDs)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
 	//insert the authors into the book_authors table
-	for _, authorName := range incomingData.Authors {
-		// Check if the author exists in the database, otherwise create a new one
-		author, err := a.AuthorModel.Get(authorName)
-		if err != nil {
-			switch err {
-			case data.ErrRecordNotFound:
-				author = &data.Author{Name: authorName}
-				err = a.AuthorModel.Insert(author)
-				if err != nil {
-					a.serverErrorResponse(w, r, err)
-					return
-				}
-			default:
-				a.serverErrorResponse(w, r, err)
-				return
-			}
-		}
+	err = tx.SetAuthors(book.ID, incomingData.Authors)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
 
-		// Create a relationship between the book and the author
-		err = a.BookAuthorModel.Insert(book.ID, author.ID)
-		if err != nil {
-			a.serverErrorResponse(w, r, err)
-			return
-		}
+	user := a.contextGetUser(r)
+	_, err = tx.RecordRevision(book.ID, &user.ID, data.RevisionCreate, nil, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// Send a response with the created book
@@ -111,13 +259,17 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 
 	data := envelope{
 		"book": bookResponse{
+			ID:              book.ID,
 			Title:           book.Title,
 			Authors:         incomingData.Authors,
 			ISBN:            book.ISBN,
 			PublicationDate: book.PublicationDate,
 			Genre:           book.Genre,
+			Genres:          genreNames,
 			Description:     book.Description,
 			AverageRating:   book.AverageRating,
+			CoverURL:        coverURL(book),
+			Series:          bookSeries(book),
 			Version:         book.Version,
 		},
 	}
@@ -138,6 +290,15 @@ func (a *applicationDependencies) getBookHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	v := validator.New()
+	includes := a.readBookIncludes(r.URL.Query(), v)
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	data.ValidateFields(v, fields, bookResponseFields)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// fetch the book from the database
 	book, authors, err := a.bookModel.Get(id)
 	if err != nil {
@@ -150,23 +311,44 @@ func (a *applicationDependencies) getBookHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	genres, err := a.genreModel.ForBook(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	_, genreNames := genreIDsAndNames(genres)
+
 	// Convert authors slice from []data.Author to []string
 	authorNames := make([]string, len(authors))
 	for i, author := range authors {
 		authorNames[i] = author.Name
 	}
 
+	var included map[int64]map[string]any
+	if len(includes) > 0 {
+		included, err = a.loadBookIncludes(a.contextGetUser(r).ID, []int64{id}, includes)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	data := envelope{
-		"book": bookResponse{
+		"book": withFields(bookResponse{
+			ID:              book.ID,
 			Title:           book.Title,
 			Authors:         authorNames,
 			ISBN:            book.ISBN,
 			PublicationDate: book.PublicationDate,
 			Genre:           book.Genre,
+			Genres:          genreNames,
 			Description:     book.Description,
 			AverageRating:   book.AverageRating,
+			CoverURL:        coverURL(book),
+			Series:          bookSeries(book),
+			Included:        included[id],
 			Version:         book.Version,
-		},
+		}, fields),
 	}
 
 	// send the response
@@ -202,7 +384,11 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 		ISBN            *string   `json:"isbn"`
 		PublicationDate *string   `json:"publication_date"`
 		Genre           *string   `json:"genre"`
+		Genres          *[]string `json:"genres"`
 		Description     *string   `json:"description"`
+		// a series_id of 0 takes the book out of its series
+		SeriesID       *int64   `json:"series_id"`
+		SeriesPosition *float64 `json:"series_position"`
 	}
 
 	err = a.readJSON(w, r, &incomingData)
@@ -227,59 +413,114 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 		}
 		book.PublicationDate = parsedPublicationDate
 	}
-	if incomingData.Genre != nil {
-		book.Genre = *incomingData.Genre
-	}
 	if incomingData.Description != nil {
 		book.Description = *incomingData.Description
 	}
-	// if authors are provided, we need to update the authors
-	if incomingData.Authors != nil {
-		// delete all the current authors
-		err = a.BookAuthorModel.Delete(id)
+
+	v := validator.New()
+
+	// "genre" changes the primary genre and keeps the others, while
+	// "genres" replaces the whole set
+	genres, err := a.genreModel.ForBook(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	genresChanged := incomingData.Genre != nil || incomingData.Genres != nil
+	if genresChanged {
+		var names []string
+		if incomingData.Genre != nil {
+			names = append(names, *incomingData.Genre)
+		}
+		if incomingData.Genres != nil {
+			names = append(names, *incomingData.Genres...)
+		} else {
+			for _, genre := range genres {
+				names = append(names, genre.Slug)
+			}
+		}
+
+		genres, err = a.resolveGenres(v, names)
 		if err != nil {
 			a.serverErrorResponse(w, r, err)
 			return
 		}
-
-		// insert the new authors
-		for _, authorName := range *incomingData.Authors {
-			// Check if the author exists in the database, otherwise create a new one
-			author, err := a.AuthorModel.Get(authorName)
-			if err != nil {
-				switch err {
-				case data.ErrRecordNotFound:
-					author = &data.Author{Name: authorName}
-					err = a.AuthorModel.Insert(author)
-					if err != nil {
-						a.serverErrorResponse(w, r, err)
-						return
-					}
-				default:
-					a.serverErrorResponse(w, r, err)
-					return
-				}
-			}
-
-			// Create a relationship between the book and the author
-			err = a.BookAuthorModel.Insert(book.ID, author.ID)
-			if err != nil {
-				a.serverErrorResponse(w, r, err)
-				return
-			}
+		book.Genre = ""
+		if len(genres) > 0 {
+			book.Genre = genres[0].Name
 		}
 	}
+	genreIDs, genreNames := genreIDsAndNames(genres)
+
+	err = a.setBookSeries(v, book, incomingData.SeriesID, incomingData.SeriesPosition)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// validate the updated book
-	v := validator.New()
 	data.ValidateBook(v, book)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// the book, its genres, its authors and the revision recording the
+	// update are saved together
+	tx, err := a.bookModel.Begin()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// the state before the update is kept for the revision history
+	before, err := tx.Snapshot(book.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// update the book in the database
-	err = a.bookModel.Update(book)
+	err = tx.Update(book)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "a book with this ISBN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if genresChanged {
+		err = tx.SetGenres(book.ID, genreIDs)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// if authors are provided, they replace the current authors
+	if incomingData.Authors != nil {
+		err = tx.SetAuthors(book.ID, *incomingData.Authors)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	user := a.contextGetUser(r)
+	_, err = tx.RecordRevision(book.ID, &user.ID, data.RevisionUpdate, before, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -300,13 +541,17 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
 
 	data := envelope{
 		"book": bookResponse{
+			ID:              book.ID,
 			Title:           book.Title,
 			Authors:         authorNames,
 			ISBN:            book.ISBN,
 			PublicationDate: book.PublicationDate,
 			Genre:           book.Genre,
+			Genres:          genreNames,
 			Description:     book.Description,
 			AverageRating:   book.AverageRating,
+			CoverURL:        coverURL(book),
+			Series:          bookSeries(book),
 			Version:         book.Version,
 		},
 	}
@@ -328,15 +573,9 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	// First, delete the relationships in the book_authors table
-	err = a.BookAuthorModel.Delete(id)
-	if err != nil {
-		a.serverErrorResponse(w, r, fmt.Errorf("unable to delete book-author relationships: %w", err))
-		return
-	}
-
-	// delete the book from the database
-	err = a.bookModel.Delete(id)
+	// move the book to the trash, it is purged after the retention period
+	user := a.contextGetUser(r)
+	err = a.bookModel.Delete(id, user.ID)
 	if err != nil {
 		switch err {
 		case data.ErrRecordNotFound:
@@ -348,7 +587,7 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 	}
 
 	data := envelope{
-		"message": "book successfully deleted",
+		"message": "book successfully moved to the trash",
 	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -356,28 +595,67 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 	}
 }
 
+// readBookCriteria reads and validates the filters of a book listing from
+// the query string
+func (a *applicationDependencies) readBookCriteria(query url.Values, v *validator.Validator) data.BookCriteria {
+	criteria := data.BookCriteria{
+		Title:           a.getSingleQueryParameter(query, "title", ""),
+		Genre:           a.getSingleQueryParameter(query, "genre", ""),
+		Tags:            a.getMultipleQueryParameters(query, "tags", nil),
+		TagMatch:        a.getSingleQueryParameter(query, "tags_match", "any"),
+		PublishedAfter:  a.getOptionalDateParameter(query, "published_after", v),
+		PublishedBefore: a.getOptionalDateParameter(query, "published_before", v),
+		MinRating:       a.getOptionalFloatParameter(query, "min_rating", v),
+		MaxRating:       a.getOptionalFloatParameter(query, "max_rating", v),
+		ISBN:            a.getSingleQueryParameter(query, "isbn", ""),
+		AuthorID:        int64(a.getSingleIntegerParameter(query, "author_id", 0, v)),
+		HasReviews:      a.getOptionalBoolParameter(query, "has_reviews", v),
+		InList:          int64(a.getSingleIntegerParameter(query, "in_list", 0, v)),
+		NotInList:       int64(a.getSingleIntegerParameter(query, "not_in_list", 0, v)),
+	}
+
+	data.ValidateBookCriteria(v, criteria)
+	return criteria
+}
+
 // list all books handler
 func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *http.Request) {
+	a.listBooks(w, r, "books")
+}
+
+// listBooks sends a page of the books matching the query string under the
+// given envelope key, the works being listed like the books
+func (a *applicationDependencies) listBooks(w http.ResponseWriter, r *http.Request, key string) {
 	var queryParametersData struct {
-		Title string
-		Genre string
+		data.BookCriteria
 		data.Filters
 	}
 
 	// Get query parameters from the URL
 	query := r.URL.Query()
-	queryParametersData.Title = a.getSingleQueryParameter(query, "title", "")
-	queryParametersData.Genre = a.getSingleQueryParameter(query, "genre", "")
 
 	v := validator.New()
 
+	queryParametersData.BookCriteria = a.readBookCriteria(query, v)
+	includes := a.readBookIncludes(query, v)
+
+	// a sparse fieldset restricts both the columns read and the JSON sent
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(query, "fields", nil)
+	queryParametersData.Filters.FieldSafeList = data.BookFields
+
 	// Set pagination and sorting
 	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, v)
 
-	// Sort by title, default is "title" for ascending order, "-title" for descending order
+	// Sort by title, default is "title" for ascending order, "-title" for descending order.
+	// Several keys can be given separated by commas, e.g. "-average_rating,title"
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "title")
-	queryParametersData.Filters.SortSafeList = []string{"id", "title", "genre", "-id", "-title", "-genre"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "title", "genre", "publication_date", "average_rating", "author", "review_count",
+		"-id", "-title", "-genre", "-publication_date", "-average_rating", "-author", "-review_count"}
+
+	// cursors from a previous page take the place of the page number
+	queryParametersData.Filters.After = a.getSingleQueryParameter(query, "after", "")
+	queryParametersData.Filters.Before = a.getSingleQueryParameter(query, "before", "")
 
 	// Validate the filters
 	data.ValidateFilters(v, queryParametersData.Filters)
@@ -387,7 +665,20 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 	}
 
 	// Fetch books from the database
-	books, metadata, err := a.bookModel.GetAll(queryParametersData.Title, queryParametersData.Genre, queryParametersData.Filters)
+	books, metadata, err := a.bookModel.GetAll(queryParametersData.BookCriteria, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.includeInBooks(r, books, includes)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Count the facets of all the matching books, not just this page
+	facets, err := a.bookModel.Facets(queryParametersData.BookCriteria)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -395,8 +686,9 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 
 	// Send the JSON response
 	data := envelope{
-		"books":     books,
+		key:         withFields(books, queryParametersData.Filters.Fields),
 		"@metadata": metadata,
+		"@facets":   facets,
 	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -407,27 +699,44 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 // // search books handler
 func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *http.Request) {
 	var queryParametersData struct {
-		Title  string
-		Author string
-		Genre  string
+		data.BookCriteria
 		data.Filters
 	}
 
 	// Get query parameters from the URL
 	query := r.URL.Query()
+	queryParametersData.Query = a.getSingleQueryParameter(query, "q", "")
 	queryParametersData.Title = a.getSingleQueryParameter(query, "title", "")
 	queryParametersData.Author = a.getSingleQueryParameter(query, "author", "")
 	queryParametersData.Genre = a.getSingleQueryParameter(query, "genre", "")
 
 	v := validator.New()
 
+	includes := a.readBookIncludes(query, v)
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(query, "fields", nil)
+	queryParametersData.Filters.FieldSafeList = data.BookSearchFields
+
+	// searches forgive typos in titles and author names unless fuzzy=false
+	fuzzy := a.getOptionalBoolParameter(query, "fuzzy", v)
+	queryParametersData.Fuzzy = fuzzy == nil || *fuzzy
+
 	// Set pagination and sorting
 	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, v)
 
-	// Sort by title, default is "title" for ascending order, "-title" for descending order
-	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "title")
-	queryParametersData.Filters.SortSafeList = []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}
+	// Full-text searches are ordered by relevance unless asked otherwise,
+	// everything else defaults to "title" in ascending order
+	defaultSort := "title"
+	if queryParametersData.Query != "" {
+		defaultSort = "relevance"
+	}
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", defaultSort)
+	queryParametersData.Filters.SortSafeList = []string{"id", "title", "genre", "publication_date", "average_rating", "author", "review_count", "relevance",
+		"-id", "-title", "-genre", "-publication_date", "-average_rating", "-author", "-review_count"}
+
+	// the best matches always come first, relevance cannot be reversed
+	v.Check(!slices.Contains(strings.Split(queryParametersData.Filters.Sort, ","), "-relevance"), "sort",
+		"relevance always sorts the best matches first, use relevance instead of -relevance")
 
 	// Validate the filters
 	data.ValidateFilters(v, queryParametersData.Filters)
@@ -437,7 +746,23 @@ func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *h
 	}
 
 	// Fetch books matching search criteria
-	books, metadata, err := a.bookModel.Search(queryParametersData.Title, queryParametersData.Author, queryParametersData.Genre, queryParametersData.Filters)
+	books, metadata, err := a.bookModel.Search(queryParametersData.BookCriteria, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	results := make([]*data.Book, len(books))
+	for i, book := range books {
+		results[i] = &book.Book
+	}
+	err = a.includeInBooks(r, results, includes)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	facets, err := a.bookModel.Facets(queryParametersData.BookCriteria)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -445,8 +770,9 @@ func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *h
 
 	// Send the JSON response
 	data := envelope{
-		"books":     books,
+		"books":     withFields(books, queryParametersData.Filters.Fields),
 		"@metadata": metadata,
+		"@facets":   facets,
 	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
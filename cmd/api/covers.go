@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/storage"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder
+)
+
+const (
+	maxCoverSize     = 5 << 20 // bytes
+	maxCoverPixels   = 40_000_000
+	coverTimeout     = time.Minute
+	thumbnailQuality = 85
+)
+
+// the thumbnails made of every cover, scaled down to the given width
+var coverSizes = []struct {
+	name  string
+	width int
+}{
+	{"small", 120},
+	{"medium", 300},
+	{"large", 600},
+}
+
+// the image types accepted as covers, as detected from their content
+var coverContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// coverPrefix is where every version of a book's cover is kept in the
+// storage
+func coverPrefix(bookID int64) string {
+	return fmt.Sprintf("covers/%d", bookID)
+}
+
+// coverKey is where a size of a version of a book's cover is kept in the
+// storage. Each upload gets a key of its own so the images served for a
+// version never change.
+func coverKey(bookID int64, version int32, size string) string {
+	return fmt.Sprintf("%s/%d/%s", coverPrefix(bookID), version, size)
+}
+
+// coverURL returns the address of a book's cover, or "" if it has none.
+// The version parameter changes with every upload so clients can cache
+// the images for good.
+func coverURL(book *data.Book) string {
+	if book.CoverUpdatedAt == nil {
+		return ""
+	}
+	return fmt.Sprintf("/v1/books/%d/cover?v=%d", book.ID, book.CoverVersion)
+}
+
+// makeThumbnail scales an image down to the width, keeping its aspect
+// ratio, and encodes it as a JPEG. Images are never scaled up.
+func makeThumbnail(src image.Image, width int) ([]byte, error) {
+	bounds := src.Bounds()
+	if bounds.Dx() < width {
+		width = bounds.Dx()
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	// JPEG has no transparency, so it is flattened onto white
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality})
+	return buf.Bytes(), err
+}
+
+// readCoverUpload reads the "cover" file out of a multipart upload
+func readCoverUpload(r *http.Request) ([]byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("the body must be a multipart/form-data upload")
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New(`the upload must contain a "cover" file`)
+			}
+			return nil, err
+		}
+		if part.FormName() != "cover" {
+			continue
+		}
+
+		// read one byte more than allowed to tell if the file is too big
+		return io.ReadAll(io.LimitReader(part, maxCoverSize+1))
+	}
+}
+
+// storedCover describes a cover saved by storeCover
+type storedCover struct {
+	contentType string
+	width       int
+	height      int
+}
+
+// storeCover checks an uploaded image, saves it along with its thumbnails
+// and records it as the cover of the book, in a revision made by the user.
+// Problems with the image are reported on the validator, in which case
+// nothing is stored.
+func (a *applicationDependencies) storeCover(book *data.Book, userID *int64, upload []byte, v *validator.Validator) (*storedCover, error) {
+	// trust the content of the file rather than its name or declared type
+	contentType := http.DetectContentType(upload)
+	v.Check(len(upload) <= maxCoverSize, "cover", fmt.Sprintf("must not be larger than %d bytes", maxCoverSize))
+	v.Check(validator.PermittedValue(contentType, coverContentTypes...), "cover", "must be a JPEG, PNG or WebP image")
+	if !v.IsEmpty() {
+		return nil, nil
+	}
+
+	// check the dimensions before decoding, a small file can still
+	// expand into an enormous image
+	config, _, err := image.DecodeConfig(bytes.NewReader(upload))
+	if err == nil && config.Width*config.Height > maxCoverPixels {
+		v.AddError("cover", fmt.Sprintf("must not have more than %d pixels", maxCoverPixels))
+		return nil, nil
+	}
+	var img image.Image
+	if err == nil {
+		img, _, err = image.Decode(bytes.NewReader(upload))
+	}
+	if err != nil {
+		v.AddError("cover", "is not a valid image")
+		return nil, nil
+	}
+
+	thumbnails := make([][]byte, len(coverSizes))
+	for i, size := range coverSizes {
+		thumbnails[i], err = makeThumbnail(img, size.width)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := a.bookModel.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The snapshot locks the book, so concurrent uploads take turns and
+	// each one is stored under the version it is about to become. Files
+	// left behind by an upload that fails are overwritten by the next one.
+	before, err := tx.Snapshot(book.ID)
+	if err != nil {
+		return nil, err
+	}
+	version := before.CoverVersion + 1
+
+	for i, size := range coverSizes {
+		err = a.storage.Put(coverKey(book.ID, version, size.name), bytes.NewReader(thumbnails[i]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = a.storage.Put(coverKey(book.ID, version, "original"), bytes.NewReader(upload))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.SetCover(book, contentType)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.RecordRevision(book.ID, userID, data.RevisionUpdate, before, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// the previous version is only removed once nothing refers to it
+	if before.CoverVersion > 0 {
+		err = a.storage.Delete(coverKey(book.ID, before.CoverVersion, ""))
+		if err != nil {
+			a.logger.Error("unable to delete previous cover", "book_id", book.ID, "version", before.CoverVersion, "error", err.Error())
+		}
+	}
+
+	return &storedCover{contentType: contentType, width: config.Width, height: config.Height}, nil
+}
+
+// upload a new cover for a book, replacing the previous one
+func (a *applicationDependencies) uploadBookCoverHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	book, _, err := a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// uploads on slow connections can take longer than the read timeout
+	err = http.NewResponseController(w).SetReadDeadline(time.Now().Add(coverTimeout))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxCoverSize+64<<10)
+	upload, err := readCoverUpload(r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			a.contentTooLargeResponse(w, r, fmt.Sprintf("the cover must not be larger than %d bytes", maxCoverSize))
+		default:
+			a.badRequestResponse(w, r, err)
+		}
+		return
+	}
+	if len(upload) > maxCoverSize {
+		a.contentTooLargeResponse(w, r, fmt.Sprintf("the cover must not be larger than %d bytes", maxCoverSize))
+		return
+	}
+
+	v := validator.New()
+	user := a.contextGetUser(r)
+	cover, err := a.storeCover(book, &user.ID, upload, v)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	url := coverURL(book)
+	sizes := map[string]string{"original": url}
+	for _, size := range coverSizes {
+		sizes[size.name] = url + "&size=" + size.name
+	}
+
+	data := envelope{
+		"cover": envelope{
+			"url":          url,
+			"content_type": cover.contentType,
+			"width":        cover.width,
+			"height":       cover.height,
+			"sizes":        sizes,
+		},
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// serve a book's cover in one of its sizes
+func (a *applicationDependencies) serveBookCoverHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	size := a.getSingleQueryParameter(query, "size", "original")
+
+	v := validator.New()
+	permittedSizes := []string{"original"}
+	for _, s := range coverSizes {
+		permittedSizes = append(permittedSizes, s.name)
+	}
+	v.Check(validator.PermittedValue(size, permittedSizes...), "size", "must be one of 'original', 'small', 'medium' or 'large'")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, _, err := a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if book.CoverUpdatedAt == nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	object, err := a.storage.Open(coverKey(bookID, book.CoverVersion, size))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer object.Close()
+
+	contentType := "image/jpeg"
+	if size == "original" {
+		contentType = book.CoverContentType
+	}
+
+	// a URL carrying the current version never changes, anything else has
+	// to be revalidated against the ETag
+	version := strconv.FormatInt(int64(book.CoverVersion), 10)
+	cacheControl := "public, max-age=300"
+	if query.Get("v") == version {
+		cacheControl = "public, max-age=31536000, immutable"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", fmt.Sprintf(`"%d-%s-%s"`, bookID, size, version))
+
+	// ServeContent answers conditional and range requests for us
+	http.ServeContent(w, r, "", *book.CoverUpdatedAt, object)
+}
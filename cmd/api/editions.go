@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// parseEditionDate parses an optional YYYY-MM-DD publication date, an empty
+// string clears it
+func parseEditionDate(v *validator.Validator, value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		v.AddError("publication_date", "must be a date in YYYY-MM-DD format")
+		return nil
+	}
+	return &date
+}
+
+// add an edition to a work
+func (a *applicationDependencies) createEditionHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		WorkID          int64  `json:"work_id"`
+		ISBN            string `json:"isbn"`
+		Format          string `json:"format"`
+		PageCount       *int   `json:"page_count"`
+		DurationMinutes *int   `json:"duration_minutes"`
+		Publisher       string `json:"publisher"`
+		Language        string `json:"language"`
+		PublicationDate string `json:"publication_date"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	edition := &data.Edition{
+		WorkID:          incomingData.WorkID,
+		ISBN:            incomingData.ISBN,
+		Format:          incomingData.Format,
+		PageCount:       incomingData.PageCount,
+		DurationMinutes: incomingData.DurationMinutes,
+		Publisher:       incomingData.Publisher,
+		Language:        incomingData.Language,
+		PublicationDate: parseEditionDate(v, incomingData.PublicationDate),
+	}
+
+	v.Check(edition.Format != "", "format", "must be provided")
+	data.ValidateEdition(v, edition)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.editionModel.Insert(edition)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("work_id", "must be an existing work")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "an edition with this ISBN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the insert does not return the title of the work
+	edition, err = a.editionModel.Get(edition.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/editions/%d", edition.ID))
+
+	data := envelope{
+		"edition": edition,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) getEditionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "edition_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	edition, err := a.editionModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"edition": edition,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// update an edition, or make it the primary edition of its work. Changes
+// to the primary edition show in the books API and in the book history.
+func (a *applicationDependencies) updateEditionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "edition_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	edition, err := a.editionModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var incomingData struct {
+		ISBN            *string `json:"isbn"`
+		Format          *string `json:"format"`
+		PageCount       *int    `json:"page_count"`
+		DurationMinutes *int    `json:"duration_minutes"`
+		Publisher       *string `json:"publisher"`
+		Language        *string `json:"language"`
+		PublicationDate *string `json:"publication_date"`
+		Primary         *bool   `json:"primary"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	wasPrimary := edition.Primary
+
+	if incomingData.ISBN != nil {
+		edition.ISBN = *incomingData.ISBN
+	}
+	if incomingData.Format != nil {
+		edition.Format = *incomingData.Format
+		// switching to or from audio drops the length that no longer applies
+		if edition.Format == "audiobook" {
+			edition.PageCount = nil
+		} else {
+			edition.DurationMinutes = nil
+		}
+	}
+	if incomingData.PageCount != nil {
+		edition.PageCount = incomingData.PageCount
+	}
+	if incomingData.DurationMinutes != nil {
+		edition.DurationMinutes = incomingData.DurationMinutes
+	}
+	if incomingData.Publisher != nil {
+		edition.Publisher = *incomingData.Publisher
+	}
+	if incomingData.Language != nil {
+		edition.Language = *incomingData.Language
+	}
+	if incomingData.PublicationDate != nil {
+		edition.PublicationDate = parseEditionDate(v, *incomingData.PublicationDate)
+	}
+	if incomingData.Primary != nil {
+		v.Check(*incomingData.Primary || !wasPrimary, "primary", "make another edition primary instead")
+		edition.Primary = *incomingData.Primary
+	}
+
+	data.ValidateEdition(v, edition)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	err = a.editionModel.Update(edition, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "an edition with this ISBN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"edition": edition,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteEditionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "edition_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.editionModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrPrimaryEdition):
+			a.conflictResponse(w, r, "the primary edition of a work cannot be deleted, make another edition primary first")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "edition successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// list the editions, of one work or of all of them
+func (a *applicationDependencies) listEditionsHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		data.EditionCriteria
+		data.Filters
+	}
+
+	query := r.URL.Query()
+
+	v := validator.New()
+
+	queryParametersData.WorkID = int64(a.getSingleIntegerParameter(query, "work_id", 0, v))
+	queryParametersData.ISBN = a.getSingleQueryParameter(query, "isbn", "")
+	queryParametersData.Format = a.getSingleQueryParameter(query, "format", "")
+	queryParametersData.Language = a.getSingleQueryParameter(query, "language", "")
+	v.Check(queryParametersData.Format == "" || validator.PermittedValue(queryParametersData.Format, data.EditionFormats...), "format", "must be one of hardcover, paperback, ebook or audiobook")
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	queryParametersData.Filters.SortSafeList = []string{"id", "format", "language", "publication_date", "page_count",
+		"-id", "-format", "-language", "-publication_date", "-page_count"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	editions, metadata, err := a.editionModel.GetAll(queryParametersData.EditionCriteria, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"editions":  editions,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/metadata"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+const (
+	metadataLookupTimeout = 10 * time.Second
+	metadataBatchSize     = 50
+	// books the provider could not complete are looked up again after this
+	metadataRecheck = 30 * 24 * time.Hour
+	// pause between lookups so the backfill does not hammer the provider
+	metadataLookupDelay = time.Second
+)
+
+// bookDraft is a book in the shape the create endpoint accepts
+type bookDraft struct {
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	ISBN            string   `json:"isbn"`
+	PublicationDate string   `json:"publication_date"`
+	Genre           string   `json:"genre"`
+	Genres          []string `json:"genres"`
+	Description     string   `json:"description"`
+}
+
+// fillBookDraft fills in the fields of a draft the client left empty with
+// what the provider found, and returns the names of the fields it filled
+func fillBookDraft(draft *bookDraft, found *metadata.Book) []string {
+	var filled []string
+	if draft.Title == "" && found.Title != "" {
+		draft.Title = found.Title
+		filled = append(filled, "title")
+	}
+	if len(draft.Authors) == 0 && len(found.Authors) > 0 {
+		draft.Authors = found.Authors
+		filled = append(filled, "authors")
+	}
+	if draft.PublicationDate == "" && found.PublicationDate != "" {
+		draft.PublicationDate = found.PublicationDate
+		filled = append(filled, "publication_date")
+	}
+	if draft.Description == "" && found.Description != "" {
+		draft.Description = found.Description
+		filled = append(filled, "description")
+	}
+	return filled
+}
+
+// fill in the blanks of a book draft from the metadata provider
+func (a *applicationDependencies) enrichBookHandler(w http.ResponseWriter, r *http.Request) {
+	if a.metadata == nil {
+		a.errorResponseJSON(w, r, http.StatusServiceUnavailable, "metadata enrichment is not enabled on this server")
+		return
+	}
+
+	var draft bookDraft
+	err := a.readJSON(w, r, &draft)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	isbn := metadata.NormalizeISBN(draft.ISBN)
+
+	v := validator.New()
+	v.Check(draft.ISBN != "", "isbn", "must be provided")
+	v.Check(draft.ISBN == "" || len(isbn) == 10 || len(isbn) == 13, "isbn", "must be an ISBN-10 or ISBN-13")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), metadataLookupTimeout)
+	defer cancel()
+
+	found, err := a.metadata.Lookup(ctx, isbn)
+	if err != nil {
+		switch {
+		case errors.Is(err, metadata.ErrNotFound):
+			a.errorResponseJSON(w, r, http.StatusNotFound, fmt.Sprintf("%s has no metadata for this ISBN", a.metadata.Name()))
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	filled := fillBookDraft(&draft, found)
+
+	exists, err := a.bookModel.ISBNExists(isbn)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"book":            draft,
+		"filled":          filled,
+		"source":          a.metadata.Name(),
+		"cover_available": found.Cover != "",
+		"cover_url":       found.CoverURL,
+		"in_catalogue":    exists,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// backfillMetadata looks up the books missing a description, authors or a
+// cover and fills in whatever the provider knows
+func (a *applicationDependencies) backfillMetadata(ctx context.Context) error {
+	for {
+		books, err := a.bookModel.GetIncomplete(metadataRecheck, metadataBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(books) == 0 {
+			return nil
+		}
+
+		for _, book := range books {
+			err := a.enrichStoredBook(ctx, book)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				a.logger.Error("metadata backfill failed", "book_id", book.ID, "error", err.Error())
+			}
+
+			// marking the book checked also keeps it out of the next batch
+			err = a.bookModel.MarkMetadataChecked(book.ID)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(metadataLookupDelay):
+			}
+		}
+	}
+}
+
+// enrichStoredBook fills in the missing metadata of a book in the catalogue
+func (a *applicationDependencies) enrichStoredBook(ctx context.Context, book *data.IncompleteBook) error {
+	lookupCtx, cancel := context.WithTimeout(ctx, metadataLookupTimeout)
+	defer cancel()
+
+	found, err := a.metadata.Lookup(lookupCtx, book.ISBN)
+	if err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	tx, err := a.bookModel.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := tx.Snapshot(book.ID)
+	if err != nil {
+		return err
+	}
+
+	if before.Description == "" && found.Description != "" {
+		_, err = tx.FillDescription(book.ID, found.Description)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(before.Authors) == 0 && len(found.Authors) > 0 {
+		err = tx.SetAuthors(book.ID, found.Authors)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the provider's changes are recorded without a user
+	_, err = tx.RecordRevision(book.ID, nil, data.RevisionUpdate, before, nil)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if book.CoverUpdatedAt == nil {
+		cover, err := a.metadata.OpenCover(lookupCtx, found)
+		if err != nil {
+			if errors.Is(err, metadata.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		defer cover.Close()
+
+		upload, err := io.ReadAll(io.LimitReader(cover, maxCoverSize+1))
+		if err != nil {
+			return err
+		}
+
+		v := validator.New()
+		_, err = a.storeCover(&book.Book, nil, upload, v)
+		if err != nil {
+			return err
+		}
+		if !v.IsEmpty() {
+			a.logger.Info("metadata backfill skipped cover", "book_id", book.ID, "reason", v.Errors["cover"])
+		}
+	}
+
+	return nil
+}
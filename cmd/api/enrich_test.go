@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/metadata"
+)
+
+func TestFillBookDraft(t *testing.T) {
+	found := &metadata.Book{
+		ISBN:            "9780441172719",
+		Title:           "Dune",
+		Authors:         []string{"Frank Herbert"},
+		Description:     "Spice.",
+		PublicationDate: "1965-08-01",
+	}
+
+	tests := []struct {
+		name       string
+		draft      bookDraft
+		found      *metadata.Book
+		want       bookDraft
+		wantFilled []string
+	}{
+		{
+			name:  "empty draft",
+			draft: bookDraft{ISBN: "9780441172719", Genre: "Science Fiction"},
+			found: found,
+			want: bookDraft{
+				Title:           "Dune",
+				Authors:         []string{"Frank Herbert"},
+				ISBN:            "9780441172719",
+				PublicationDate: "1965-08-01",
+				Genre:           "Science Fiction",
+				Description:     "Spice.",
+			},
+			wantFilled: []string{"title", "authors", "publication_date", "description"},
+		},
+		{
+			name: "the client's values are kept",
+			draft: bookDraft{
+				Title:       "Dune (Deluxe Edition)",
+				Authors:     []string{"F. Herbert"},
+				ISBN:        "9780441172719",
+				Description: "A classic.",
+			},
+			found: found,
+			want: bookDraft{
+				Title:           "Dune (Deluxe Edition)",
+				Authors:         []string{"F. Herbert"},
+				ISBN:            "9780441172719",
+				PublicationDate: "1965-08-01",
+				Description:     "A classic.",
+			},
+			wantFilled: []string{"publication_date"},
+		},
+		{
+			name:       "the provider knows nothing more",
+			draft:      bookDraft{ISBN: "9780441172719"},
+			found:      &metadata.Book{ISBN: "9780441172719"},
+			want:       bookDraft{ISBN: "9780441172719"},
+			wantFilled: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draft := tt.draft
+			filled := fillBookDraft(&draft, tt.found)
+			if !reflect.DeepEqual(draft, tt.want) {
+				t.Errorf("got draft %+v, want %+v", draft, tt.want)
+			}
+			if !reflect.DeepEqual(filled, tt.wantFilled) {
+				t.Errorf("got filled %q, want %q", filled, tt.wantFilled)
+			}
+		})
+	}
+}
@@ -82,6 +82,17 @@ func (a *applicationDependencies) editConflictResponse(w http.ResponseWriter, r
 
 }
 
+// send an error response if the request conflicts with the current state
+// of the resource (409)
+func (a *applicationDependencies) conflictResponse(w http.ResponseWriter, r *http.Request, message string) {
+	a.errorResponseJSON(w, r, http.StatusConflict, message)
+}
+
+// send an error response if the request body is too large (413)
+func (a *applicationDependencies) contentTooLargeResponse(w http.ResponseWriter, r *http.Request, message string) {
+	a.errorResponseJSON(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
 // Return a 401 status code
 func (a *applicationDependencies) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
@@ -106,3 +117,9 @@ func (a *applicationDependencies) inactiveAccountResponse(w http.ResponseWriter,
 	message := "your user account must be activated to access this resource"
 	a.errorResponseJSON(w, r, http.StatusForbidden, message)
 }
+
+// the user is signed in but lacks the permission for the resource (403)
+func (a *applicationDependencies) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	a.errorResponseJSON(w, r, http.StatusForbidden, message)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+const exportWriteTimeout = 10 * time.Minute
+
+// bookExporter writes books in one of the export formats. Begin is called
+// before the first book and End after the last one.
+type bookExporter interface {
+	Begin() error
+	Write(book *data.ExportedBook) error
+	End() error
+}
+
+// the export formats with their content type and file extension
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"csv":     {"text/csv; charset=utf-8", "csv"},
+	"jsonl":   {"application/x-ndjson", "jsonl"},
+	"marcxml": {"application/marcxml+xml", "xml"},
+	"dc":      {"application/xml", "xml"},
+}
+
+func newBookExporter(format string, w io.Writer) bookExporter {
+	switch format {
+	case "csv":
+		return &csvBookExporter{writer: csv.NewWriter(w)}
+	case "jsonl":
+		return &jsonlBookExporter{encoder: json.NewEncoder(w)}
+	case "marcxml":
+		return &marcBookExporter{w: w, encoder: xml.NewEncoder(w)}
+	default:
+		return &dublinCoreBookExporter{w: w, encoder: xml.NewEncoder(w)}
+	}
+}
+
+type csvBookExporter struct {
+	writer *csv.Writer
+}
+
+func (e *csvBookExporter) Begin() error {
+	// the same columns the importer reads, plus the id and average rating
+	return e.writer.Write([]string{"id", "title", "authors", "isbn", "publication_date", "genre", "genres", "description", "average_rating"})
+}
+
+func (e *csvBookExporter) Write(book *data.ExportedBook) error {
+	return e.writer.Write([]string{
+		strconv.FormatInt(book.ID, 10),
+		book.Title,
+		strings.Join(book.Authors, "; "),
+		book.ISBN,
+		book.PublicationDate.Format("2006-01-02"),
+		book.Genre,
+		strings.Join(book.Genres, "; "),
+		book.Description,
+		strconv.FormatFloat(book.AverageRating, 'f', 2, 64),
+	})
+}
+
+func (e *csvBookExporter) End() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type jsonlBookExporter struct {
+	encoder *json.Encoder
+}
+
+func (e *jsonlBookExporter) Begin() error {
+	return nil
+}
+
+func (e *jsonlBookExporter) Write(book *data.ExportedBook) error {
+	// Encode ends every value with a newline
+	return e.encoder.Encode(struct {
+		ID              int64    `json:"id"`
+		Title           string   `json:"title"`
+		Authors         []string `json:"authors"`
+		ISBN            string   `json:"isbn"`
+		PublicationDate string   `json:"publication_date"`
+		Genre           string   `json:"genre"`
+		Genres          []string `json:"genres"`
+		Description     string   `json:"description"`
+		AverageRating   float64  `json:"average_rating"`
+	}{
+		ID:              book.ID,
+		Title:           book.Title,
+		Authors:         book.Authors,
+		ISBN:            book.ISBN,
+		PublicationDate: book.PublicationDate.Format("2006-01-02"),
+		Genre:           book.Genre,
+		Genres:          book.Genres,
+		Description:     book.Description,
+		AverageRating:   book.AverageRating,
+	})
+}
+
+func (e *jsonlBookExporter) End() error {
+	return nil
+}
+
+// MARC 21 slim records, see https://www.loc.gov/standards/marcxml/
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDatafield struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcControlfield struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"record"`
+	Leader        string             `xml:"leader"`
+	Controlfields []marcControlfield `xml:"controlfield"`
+	Datafields    []marcDatafield    `xml:"datafield"`
+}
+
+type marcBookExporter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+}
+
+func (e *marcBookExporter) Begin() error {
+	_, err := io.WriteString(e.w, xml.Header+`<collection xmlns="http://www.loc.gov/MARC21/slim">`+"\n")
+	return err
+}
+
+func (e *marcBookExporter) Write(book *data.ExportedBook) error {
+	field := func(tag, ind1, ind2 string, subfields ...marcSubfield) marcDatafield {
+		return marcDatafield{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: subfields}
+	}
+
+	record := marcRecord{
+		// language material, monograph, Unicode, core level, AACR2
+		Leader: "     nam a22     4a 4500",
+		Controlfields: []marcControlfield{
+			{Tag: "001", Value: strconv.FormatInt(book.ID, 10)},
+		},
+	}
+
+	record.Datafields = append(record.Datafields, field("020", " ", " ", marcSubfield{"a", book.ISBN}))
+	for i, author := range book.Authors {
+		// the first author is the main entry, the others added entries
+		tag := "700"
+		if i == 0 {
+			tag = "100"
+		}
+		record.Datafields = append(record.Datafields, field(tag, "1", " ", marcSubfield{"a", author}))
+	}
+
+	titleIndicator := "0"
+	if len(book.Authors) > 0 {
+		titleIndicator = "1"
+	}
+	record.Datafields = append(record.Datafields,
+		field("245", titleIndicator, "0", marcSubfield{"a", book.Title}),
+		field("264", " ", "1", marcSubfield{"c", book.PublicationDate.Format("2006")}),
+		field("520", " ", " ", marcSubfield{"a", book.Description}),
+	)
+	for _, genre := range book.Genres {
+		record.Datafields = append(record.Datafields, field("655", " ", "4", marcSubfield{"a", genre}))
+	}
+
+	err := e.encoder.Encode(record)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, "\n")
+	return err
+}
+
+func (e *marcBookExporter) End() error {
+	_, err := io.WriteString(e.w, "</collection>\n")
+	return err
+}
+
+// simple Dublin Core records in the oai_dc container
+type dublinCoreRecord struct {
+	XMLName     xml.Name `xml:"oai_dc:dc"`
+	Title       string   `xml:"dc:title"`
+	Creators    []string `xml:"dc:creator"`
+	Subjects    []string `xml:"dc:subject"`
+	Description string   `xml:"dc:description"`
+	Date        string   `xml:"dc:date"`
+	Type        string   `xml:"dc:type"`
+	Identifiers []string `xml:"dc:identifier"`
+}
+
+type dublinCoreBookExporter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+}
+
+func (e *dublinCoreBookExporter) Begin() error {
+	_, err := io.WriteString(e.w, xml.Header+
+		`<records xmlns:oai_dc="http://www.openarchives.org/OAI/2.0/oai_dc/" xmlns:dc="http://purl.org/dc/elements/1.1/">`+"\n")
+	return err
+}
+
+func (e *dublinCoreBookExporter) Write(book *data.ExportedBook) error {
+	record := dublinCoreRecord{
+		Title:       book.Title,
+		Creators:    book.Authors,
+		Subjects:    book.Genres,
+		Description: book.Description,
+		Date:        book.PublicationDate.Format("2006-01-02"),
+		Type:        "Text",
+		Identifiers: []string{"urn:isbn:" + book.ISBN, fmt.Sprintf("/v1/books/%d", book.ID)},
+	}
+
+	err := e.encoder.Encode(record)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, "\n")
+	return err
+}
+
+func (e *dublinCoreBookExporter) End() error {
+	_, err := io.WriteString(e.w, "</records>\n")
+	return err
+}
+
+// trackingWriter remembers whether anything reached the client, after
+// that an error can no longer be sent as a JSON response
+type trackingWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.written = true
+	return t.w.Write(p)
+}
+
+// stream the catalogue in one of the export formats
+func (a *applicationDependencies) exportBooksHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	v := validator.New()
+	criteria := a.readBookCriteria(query, v)
+	format := a.getSingleQueryParameter(query, "format", "csv")
+	_, ok := exportFormats[format]
+	v.Check(ok, "format", "must be one of 'csv', 'jsonl', 'marcxml' or 'dc'")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// exporting a large catalogue can take longer than the write timeout
+	err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tracker := &trackingWriter{w: w}
+	buffer := bufio.NewWriter(tracker)
+	exporter := newBookExporter(format, buffer)
+
+	w.Header().Set("Content-Type", exportFormats[format].contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="books.%s"`, exportFormats[format].extension))
+
+	err = exporter.Begin()
+	if err == nil {
+		err = a.bookModel.Export(criteria, exporter.Write)
+	}
+	if err == nil {
+		err = exporter.End()
+	}
+	if err == nil {
+		err = buffer.Flush()
+	}
+	if err != nil {
+		if !tracker.written {
+			w.Header().Del("Content-Disposition")
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		// the response is already on its way, all we can do is log it
+		a.logError(r, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// validateGenreParent checks that the parent of a genre exists and is not
+// the genre itself or one of its descendants
+func (a *applicationDependencies) validateGenreParent(v *validator.Validator, genre *data.Genre) error {
+	if genre.ParentID == nil {
+		return nil
+	}
+
+	_, err := a.genreModel.Get(*genre.ParentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must be an existing genre")
+			return nil
+		default:
+			return err
+		}
+	}
+
+	// a new genre has no descendants yet
+	if genre.ID == 0 {
+		return nil
+	}
+
+	cycle, err := a.genreModel.IsDescendant(genre.ID, *genre.ParentID)
+	if err != nil {
+		return err
+	}
+	v.Check(!cycle, "parent_id", "must not be the genre itself or one of its descendants")
+	return nil
+}
+
+func (a *applicationDependencies) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Name     string `json:"name"`
+		Slug     string `json:"slug"`
+		ParentID *int64 `json:"parent_id"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the slug is derived from the name unless one is given
+	slug := incomingData.Slug
+	if slug == "" {
+		slug = incomingData.Name
+	}
+
+	genre := &data.Genre{
+		Name:     incomingData.Name,
+		Slug:     data.Slugify(slug),
+		ParentID: incomingData.ParentID,
+	}
+
+	v := validator.New()
+	data.ValidateGenre(v, genre)
+	err = a.validateGenreParent(v, genre)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.genreModel.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a genre with this slug already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%d", genre.ID))
+
+	data := envelope{
+		"genre": genre,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) getGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "genre_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	genre, err := a.genreModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"genre": genre,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "genre_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	genre, err := a.genreModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var incomingData struct {
+		Name     *string `json:"name"`
+		Slug     *string `json:"slug"`
+		ParentID *int64  `json:"parent_id"`
+		// a top-level genre is made by setting "top_level" since a null
+		// parent_id cannot be told apart from a missing one
+		TopLevel *bool `json:"top_level"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Name != nil {
+		genre.Name = *incomingData.Name
+	}
+	if incomingData.Slug != nil {
+		genre.Slug = data.Slugify(*incomingData.Slug)
+	}
+	if incomingData.ParentID != nil {
+		genre.ParentID = incomingData.ParentID
+	}
+	if incomingData.TopLevel != nil && *incomingData.TopLevel {
+		genre.ParentID = nil
+	}
+
+	v := validator.New()
+	data.ValidateGenre(v, genre)
+	err = a.validateGenreParent(v, genre)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.genreModel.Update(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "a genre with this slug already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"genre": genre,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "genre_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.genreModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrGenreInUse):
+			a.conflictResponse(w, r, "the genre is still assigned to books and cannot be deleted")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "genre successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		Name     string
+		ParentID int
+		data.Filters
+	}
+
+	query := r.URL.Query()
+	queryParametersData.Name = a.getSingleQueryParameter(query, "name", "")
+
+	v := validator.New()
+
+	queryParametersData.ParentID = a.getSingleIntegerParameter(query, "parent_id", 0, v)
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 100, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "name")
+	queryParametersData.Filters.SortSafeList = []string{"id", "name", "slug", "-id", "-name", "-slug"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, metadata, err := a.genreModel.GetAll(queryParametersData.Name, int64(queryParametersData.ParentID), queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"genres":    genres,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
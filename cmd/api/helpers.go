@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/validator"
 	"github.com/julienschmidt/httprouter"
@@ -16,6 +17,65 @@ import (
 
 type envelope map[string]any
 
+// sparse limits the JSON of a resource, or of each resource in a list, to
+// the fields of a sparse fieldset, in the order they were asked for
+type sparse struct {
+	value  any
+	fields []string
+}
+
+// withFields wraps an envelope value so only the fields are sent, all of
+// them when the fieldset is empty
+func withFields(value any, fields []string) any {
+	if len(fields) == 0 {
+		return value
+	}
+	return sparse{value: value, fields: fields}
+}
+
+func (s sparse) MarshalJSON() ([]byte, error) {
+	js, err := json.Marshal(s.value)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []json.RawMessage
+	if json.Unmarshal(js, &list) != nil || list == nil {
+		return s.pick(js)
+	}
+	for i, item := range list {
+		list[i], err = s.pick(item)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(list)
+}
+
+// pick keeps the fields of a JSON object, anything else is kept as it is
+func (s sparse) pick(js []byte) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(js, &object) != nil || object == nil {
+		return js, nil
+	}
+
+	kept := make([]string, 0, len(s.fields))
+	for _, field := range s.fields {
+		value, ok := object[field]
+		if !ok {
+			continue
+		}
+		key, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, string(key)+":"+string(value))
+		// a field asked for twice is only sent once
+		delete(object, field)
+	}
+	return []byte("{" + strings.Join(kept, ",") + "}"), nil
+}
+
 func (a *applicationDependencies) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 
 	jsResponse, err := json.MarshalIndent(data, "", "\t")
@@ -132,15 +192,15 @@ func (a *applicationDependencies) getSingleQueryParameter(queryParameters url.Va
 }
 
 // call when we have multiple comma-separated values
-// func (a *applicationDependencies) getMultipleQueryParameters(queryParameters url.Values, key string, defaultValue []string) []string {
+func (a *applicationDependencies) getMultipleQueryParameters(queryParameters url.Values, key string, defaultValue []string) []string {
 
-// 	result := queryParameters.Get(key)
-// 	if result == "" {
-// 		return defaultValue
-// 	}
-// 	return strings.Split(result, ",")
+	result := queryParameters.Get(key)
+	if result == "" {
+		return defaultValue
+	}
+	return strings.Split(result, ",")
 
-// }
+}
 
 // this method can cause a validation error when trying to convert the
 // string to a valid integer value
@@ -161,6 +221,49 @@ func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.
 
 }
 
+// the optional parameters below return nil when the parameter is missing,
+// so that a zero value can still be asked for
+
+func (a *applicationDependencies) getOptionalFloatParameter(queryParameters url.Values, key string, v *validator.Validator) *float64 {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+	floatValue, err := strconv.ParseFloat(result, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return nil
+	}
+	return &floatValue
+}
+
+func (a *applicationDependencies) getOptionalBoolParameter(queryParameters url.Values, key string, v *validator.Validator) *bool {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+	boolValue, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return nil
+	}
+	return &boolValue
+}
+
+// dates are expected in the YYYY-MM-DD format
+func (a *applicationDependencies) getOptionalDateParameter(queryParameters url.Values, key string, v *validator.Validator) *time.Time {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", result)
+	if err != nil {
+		v.AddError(key, "must be a date in the YYYY-MM-DD format")
+		return nil
+	}
+	return &date
+}
+
 // Accept a function and run it in the background also recover from any panic
 func (a *applicationDependencies) background(fn func()) {
 	a.wg.Add(1) // Use a wait group to ensure all goroutines finish before we exit
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSparseMarshalJSON(t *testing.T) {
+	type item struct {
+		ID    int64  `json:"id"`
+		Title string `json:"title"`
+		Genre string `json:"genre"`
+	}
+	dune := item{ID: 1, Title: "Dune", Genre: "Science Fiction"}
+	emma := item{ID: 2, Title: "Emma", Genre: "Romance"}
+
+	tests := []struct {
+		name   string
+		value  any
+		fields []string
+		want   string
+	}{
+		{
+			name:   "no fieldset",
+			value:  dune,
+			fields: nil,
+			want:   `{"id":1,"title":"Dune","genre":"Science Fiction"}`,
+		},
+		{
+			name:   "object",
+			value:  dune,
+			fields: []string{"title", "id"},
+			want:   `{"title":"Dune","id":1}`,
+		},
+		{
+			name:   "pointer",
+			value:  &dune,
+			fields: []string{"genre"},
+			want:   `{"genre":"Science Fiction"}`,
+		},
+		{
+			name:   "list",
+			value:  []*item{&dune, &emma},
+			fields: []string{"id"},
+			want:   `[{"id":1},{"id":2}]`,
+		},
+		{
+			name:   "empty list",
+			value:  []*item{},
+			fields: []string{"id"},
+			want:   `[]`,
+		},
+		{
+			name:   "field asked for twice",
+			value:  dune,
+			fields: []string{"id", "id"},
+			want:   `{"id":1}`,
+		},
+		{
+			name:   "unknown field",
+			value:  dune,
+			fields: []string{"price"},
+			want:   `{}`,
+		},
+		{
+			name:   "not an object",
+			value:  []string{"Dune"},
+			fields: []string{"id"},
+			want:   `["Dune"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(withFields(tt.value, tt.fields))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
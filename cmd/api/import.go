@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+const (
+	maxImportBytes      = 10 << 20  // limit for imports done within the request
+	maxAsyncImportBytes = 100 << 20 // limit for imports run as a background job
+	importTimeout       = 10 * time.Minute
+)
+
+// importRecord is one book read from an import file. In CSV files the
+// authors and genres columns separate their values with semicolons.
+type importRecord struct {
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	ISBN            string   `json:"isbn"`
+	PublicationDate string   `json:"publication_date"`
+	Genre           string   `json:"genre"`
+	Genres          []string `json:"genres"`
+	Description     string   `json:"description"`
+}
+
+// importFileError is an error in the import file that stops the import
+type importFileError struct {
+	err error
+}
+
+func (e *importFileError) Error() string {
+	return e.err.Error()
+}
+
+func (e *importFileError) Unwrap() error {
+	return e.err
+}
+
+// importRowError is a malformed record, the import carries on with the
+// next one
+type importRowError struct {
+	err error
+}
+
+func (e *importRowError) Error() string {
+	return e.err.Error()
+}
+
+// importReader streams the records out of an import file. Next returns
+// io.EOF once all records were read.
+type importReader interface {
+	Next() (*importRecord, error)
+}
+
+// newImportReader returns a reader for the format ("csv" or "jsonl")
+func newImportReader(format string, r io.Reader) (importReader, error) {
+	switch format {
+	case "csv":
+		return newCSVImportReader(r)
+	case "jsonl":
+		return &jsonlImportReader{reader: bufio.NewReader(r)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// the columns an import CSV file may have, title is required
+var csvImportColumns = []string{"title", "authors", "isbn", "publication_date", "genre", "genres", "description"}
+
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, &importFileError{errors.New("the CSV file must start with a header row")}
+		}
+		return nil, &importFileError{err}
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.PermittedValue(name, csvImportColumns...) {
+			return nil, &importFileError{fmt.Errorf("the CSV header contains unknown column %q", name)}
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, &importFileError{errors.New("the CSV header must contain a title column")}
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvImportReader) Next() (*importRecord, error) {
+	fields, err := c.reader.Read()
+	if err != nil {
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil, io.EOF
+		case errors.Is(err, csv.ErrFieldCount):
+			return nil, &importRowError{errors.New("the row does not have the same number of fields as the header")}
+		default:
+			return nil, &importFileError{err}
+		}
+	}
+
+	field := func(name string) string {
+		i, ok := c.columns[name]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+
+	return &importRecord{
+		Title:           field("title"),
+		Authors:         splitImportList(field("authors")),
+		ISBN:            field("isbn"),
+		PublicationDate: field("publication_date"),
+		Genre:           field("genre"),
+		Genres:          splitImportList(field("genres")),
+		Description:     field("description"),
+	}, nil
+}
+
+// splitImportList splits a semicolon-separated CSV field
+func splitImportList(field string) []string {
+	var values []string
+	for _, value := range strings.Split(field, ";") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+type jsonlImportReader struct {
+	reader *bufio.Reader
+}
+
+func (j *jsonlImportReader) Next() (*importRecord, error) {
+	for {
+		line, err := j.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, &importFileError{err}
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			// blank lines are not records
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		var record importRecord
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		decodeErr := dec.Decode(&record)
+		if decodeErr != nil {
+			return nil, &importRowError{fmt.Errorf("the line is not a valid book: %w", decodeErr)}
+		}
+		return &record, nil
+	}
+}
+
+// importBooks creates a book for every record the reader returns and
+// reports on each row. Rows whose ISBN is already in the catalogue (or
+// earlier in the file) are skipped. In a dry run the rows are only
+// validated. The report so far is returned along with any error that
+// stopped the import. The books are recorded in their history as created
+// by userID.
+func (a *applicationDependencies) importBooks(reader importReader, dryRun bool, userID int64) (*data.ImportReport, error) {
+	report := &data.ImportReport{DryRun: dryRun, Rows: []*data.ImportRowResult{}}
+	seenISBNs := make(map[string]bool)
+
+	for row := 1; ; row++ {
+		record, err := reader.Next()
+		if err != nil {
+			var rowError *importRowError
+			switch {
+			case errors.Is(err, io.EOF):
+				return report, nil
+			case errors.As(err, &rowError):
+				report.Add(&data.ImportRowResult{
+					Row:    row,
+					Status: data.ImportRowFailed,
+					Errors: map[string]string{"row": rowError.Error()},
+				})
+				continue
+			default:
+				return report, err
+			}
+		}
+
+		result, err := a.importRecord(record, dryRun, seenISBNs, userID)
+		if err != nil {
+			return report, err
+		}
+		result.Row = row
+		report.Add(result)
+	}
+}
+
+// importRecord validates and, unless it is a dry run, creates one book
+func (a *applicationDependencies) importRecord(record *importRecord, dryRun bool, seenISBNs map[string]bool, userID int64) (*data.ImportRowResult, error) {
+	result := &data.ImportRowResult{
+		Title: record.Title,
+		ISBN:  record.ISBN,
+	}
+
+	v := validator.New()
+	v.Check(len(record.Authors) > 0, "authors", "must be provided")
+
+	book := &data.Book{
+		Title:       record.Title,
+		ISBN:        record.ISBN,
+		Genre:       record.Genre,
+		Description: record.Description,
+	}
+	if record.PublicationDate != "" {
+		publicationDate, err := time.Parse("2006-01-02", record.PublicationDate)
+		if err != nil {
+			v.AddError("publication_date", "must be a date in the YYYY-MM-DD format")
+		}
+		book.PublicationDate = publicationDate
+	}
+
+	genres, err := a.resolveGenres(v, append([]string{record.Genre}, record.Genres...))
+	if err != nil {
+		return nil, err
+	}
+	if len(genres) > 0 {
+		book.Genre = genres[0].Name
+	}
+
+	data.ValidateBook(v, book)
+	if !v.IsEmpty() {
+		result.Status = data.ImportRowFailed
+		result.Errors = v.Errors
+		return result, nil
+	}
+
+	if seenISBNs[book.ISBN] {
+		result.Status = data.ImportRowSkipped
+		result.Errors = map[string]string{"isbn": "the ISBN appears on an earlier row"}
+		return result, nil
+	}
+	seenISBNs[book.ISBN] = true
+
+	exists, err := a.bookModel.ISBNExists(book.ISBN)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		result.Status = data.ImportRowSkipped
+		result.Errors = map[string]string{"isbn": "a book with this ISBN already exists"}
+		return result, nil
+	}
+
+	result.Status = data.ImportRowCreated
+	if dryRun {
+		return result, nil
+	}
+
+	// a row is saved with its genres, authors and revision or not at all
+	tx, err := a.bookModel.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.Insert(book)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			result.Status = data.ImportRowSkipped
+			result.Errors = map[string]string{"isbn": "a book with this ISBN already exists"}
+			return result, nil
+		default:
+			return nil, err
+		}
+	}
+
+	genreIDs, _ := genreIDsAndNames(genres)
+	err = tx.SetGenres(book.ID, genreIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.SetAuthors(book.ID, record.Authors)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.RecordRevision(book.ID, &userID, data.RevisionCreate, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	result.BookID = book.ID
+
+	return result, nil
+}
+
+// importFormat works out the format of an import from the format query
+// parameter, falling back to the Content-Type of the request
+func (a *applicationDependencies) importFormat(r *http.Request) string {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	defaultFormat := ""
+	switch contentType {
+	case "text/csv":
+		defaultFormat = "csv"
+	case "application/jsonl", "application/x-ndjson", "application/x-jsonlines":
+		defaultFormat = "jsonl"
+	}
+
+	return a.getSingleQueryParameter(r.URL.Query(), "format", defaultFormat)
+}
+
+// import books from a CSV or JSON Lines file in the request body
+func (a *applicationDependencies) importBooksHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := a.importFormat(r)
+	dryRun := a.getSingleQueryParameter(query, "dry_run", "false")
+	async := a.getSingleQueryParameter(query, "async", "false")
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(format, "csv", "jsonl"), "format", "must be either 'csv' or 'jsonl' (or send a text/csv or application/x-ndjson Content-Type)")
+	v.Check(validator.PermittedValue(dryRun, "true", "false"), "dry_run", "must be either 'true' or 'false'")
+	v.Check(validator.PermittedValue(async, "true", "false"), "async", "must be either 'true' or 'false'")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// reading a large file can take longer than the server timeouts allow
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(time.Now().Add(importTimeout))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	err = rc.SetWriteDeadline(time.Now().Add(importTimeout))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if async == "true" {
+		a.startImportJob(w, r, format, dryRun == "true")
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	reader, err := newImportReader(format, body)
+	if err != nil {
+		a.importErrorResponse(w, r, err)
+		return
+	}
+
+	report, err := a.importBooks(reader, dryRun == "true", a.contextGetUser(r).ID)
+	if err != nil {
+		a.importErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"report": report,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// importErrorResponse sends the response for an error that stopped an
+// import, problems with the file are the client's fault
+func (a *applicationDependencies) importErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	var fileError *importFileError
+
+	switch {
+	case errors.As(err, &maxBytesError):
+		a.badRequestResponse(w, r, fmt.Errorf("the body must not be larger than %d bytes, use async=true for larger files", maxBytesError.Limit))
+	case errors.As(err, &fileError):
+		a.badRequestResponse(w, r, fileError)
+	default:
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// startImportJob saves the request body to a temporary file and imports
+// it in the background. The client polls the job for the report.
+func (a *applicationDependencies) startImportJob(w http.ResponseWriter, r *http.Request, format string, dryRun bool) {
+	file, err := os.CreateTemp("", "bookclub-import-*")
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxAsyncImportBytes)
+	_, err = io.Copy(file, body)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		a.importErrorResponse(w, r, err)
+		return
+	}
+	file.Close()
+
+	job := &data.ImportJob{
+		UserID: a.contextGetUser(r).ID,
+		Format: format,
+		DryRun: dryRun,
+	}
+	err = a.importJobModel.Insert(job)
+	if err != nil {
+		os.Remove(file.Name())
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.background(func() {
+		defer os.Remove(file.Name())
+		a.runImportJob(job, file.Name())
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%d", job.ID))
+
+	data := envelope{
+		"import": job,
+	}
+	err = a.writeJSON(w, http.StatusAccepted, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// runImportJob imports a saved file and records the outcome on the job
+func (a *applicationDependencies) runImportJob(job *data.ImportJob, path string) {
+	err := a.importJobModel.SetRunning(job.ID)
+	if err != nil {
+		a.logger.Error(err.Error(), "import_id", job.ID)
+		return
+	}
+
+	report := &data.ImportReport{DryRun: job.DryRun, Rows: []*data.ImportRowResult{}}
+	failure := ""
+
+	file, err := os.Open(path)
+	if err == nil {
+		defer file.Close()
+
+		var reader importReader
+		reader, err = newImportReader(job.Format, file)
+		if err == nil {
+			report, err = a.importBooks(reader, job.DryRun, job.UserID)
+		}
+	}
+	if err != nil {
+		// the error is shown to the client, so only file problems are detailed
+		var fileError *importFileError
+		failure = "the import stopped because of a server error"
+		if errors.As(err, &fileError) {
+			failure = fileError.Error()
+		} else {
+			a.logger.Error(err.Error(), "import_id", job.ID)
+		}
+	}
+
+	err = a.importJobModel.Finish(job.ID, report, failure)
+	if err != nil {
+		a.logger.Error(err.Error(), "import_id", job.ID)
+	}
+}
+
+// get the status and report of a background import
+func (a *applicationDependencies) getImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "import_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	job, err := a.importJobModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// users only get to see their own imports
+	if job.UserID != a.contextGetUser(r).ID {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	data := envelope{
+		"import": job,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
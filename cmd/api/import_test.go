@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readImport reads all the records of an import file, recording the
+// malformed rows as nil records
+func readImport(t *testing.T, reader importReader) []*importRecord {
+	t.Helper()
+
+	var records []*importRecord
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		var rowError *importRowError
+		if errors.As(err, &rowError) {
+			records = append(records, nil)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestCSVImportReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		fileErr bool
+		want    []*importRecord
+	}{
+		{
+			name:    "empty file",
+			input:   "",
+			fileErr: true,
+		},
+		{
+			name:    "unknown column",
+			input:   "title,price\nDune,10\n",
+			fileErr: true,
+		},
+		{
+			name:    "no title column",
+			input:   "isbn,genre\n9780441172719,Science Fiction\n",
+			fileErr: true,
+		},
+		{
+			name:  "header only",
+			input: "title,authors\n",
+		},
+		{
+			name:  "all columns",
+			input: "Title, Authors ,ISBN,publication_date,genre,genres,description\nDune,Frank Herbert,9780441172719,1965-08-01,Science Fiction,Classics; Adventure,Spice.\n",
+			want: []*importRecord{{
+				Title:           "Dune",
+				Authors:         []string{"Frank Herbert"},
+				ISBN:            "9780441172719",
+				PublicationDate: "1965-08-01",
+				Genre:           "Science Fiction",
+				Genres:          []string{"Classics", "Adventure"},
+				Description:     "Spice.",
+			}},
+		},
+		{
+			name:  "columns in any order",
+			input: "authors,title\n\"Terry Pratchett; Neil Gaiman\",Good Omens\n",
+			want: []*importRecord{{
+				Title:   "Good Omens",
+				Authors: []string{"Terry Pratchett", "Neil Gaiman"},
+			}},
+		},
+		{
+			name:  "short row is skipped",
+			input: "title,isbn\nDune\nEmma,9780141439587\n",
+			want: []*importRecord{
+				nil,
+				{Title: "Emma", ISBN: "9780141439587"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := newImportReader("csv", strings.NewReader(tt.input))
+			var fileError *importFileError
+			if tt.fileErr {
+				if !errors.As(err, &fileError) {
+					t.Fatalf("got error %v, want an import file error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := readImport(t, reader)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLImportReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []*importRecord
+	}{
+		{
+			name:  "empty file",
+			input: "",
+		},
+		{
+			name:  "blank lines are ignored",
+			input: "\n{\"title\": \"Dune\", \"authors\": [\"Frank Herbert\"]}\n\n  \n",
+			want:  []*importRecord{{Title: "Dune", Authors: []string{"Frank Herbert"}}},
+		},
+		{
+			name:  "last line without a newline",
+			input: "{\"title\": \"Dune\"}\n{\"title\": \"Emma\", \"genres\": [\"Romance\"]}",
+			want: []*importRecord{
+				{Title: "Dune"},
+				{Title: "Emma", Genres: []string{"Romance"}},
+			},
+		},
+		{
+			name:  "malformed lines are skipped",
+			input: "{\"title\": \"Dune\", \"price\": 10}\nnot json\n{\"title\": \"Emma\"}\n",
+			want: []*importRecord{
+				nil,
+				nil,
+				{Title: "Emma"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := newImportReader("jsonl", strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := readImport(t, reader)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewImportReaderFormat(t *testing.T) {
+	_, err := newImportReader("xlsx", strings.NewReader(""))
+	if err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestSplitImportList(t *testing.T) {
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{"", nil},
+		{"Fantasy", []string{"Fantasy"}},
+		{" Fantasy ; Horror;", []string{"Fantasy", "Horror"}},
+		{";;", nil},
+	}
+
+	for _, tt := range tests {
+		if got := splitImportList(tt.field); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitImportList(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// the related data a book listing or book can include
+var bookIncludes = []string{"authors", "genres", "series", "recent_reviews", "my_review", "my_lists"}
+
+// how many of the latest reviews recent_reviews includes for each book
+const recentReviewsPerBook = 3
+
+// readBookIncludes reads and validates the comma-separated include
+// parameter
+func (a *applicationDependencies) readBookIncludes(query url.Values, v *validator.Validator) []string {
+	includes := a.getMultipleQueryParameters(query, "include", nil)
+	for _, include := range includes {
+		if !validator.PermittedValue(include, bookIncludes...) {
+			v.AddError("include", "must be a comma-separated list of authors, genres, series, recent_reviews, my_review or my_lists")
+			break
+		}
+	}
+	return includes
+}
+
+// orEmpty turns a nil slice into an empty one so it is sent as []
+func orEmpty[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// loadBookIncludes loads the included data of the books, by book ID, with
+// one query per include whatever the number of books. my_review and
+// my_lists are those of the user.
+func (a *applicationDependencies) loadBookIncludes(userID int64, bookIDs []int64, includes []string) (map[int64]map[string]any, error) {
+	included := make(map[int64]map[string]any, len(bookIDs))
+	for _, id := range bookIDs {
+		included[id] = map[string]any{}
+	}
+	if len(bookIDs) == 0 {
+		return included, nil
+	}
+
+	for _, include := range includes {
+		switch include {
+		case "authors":
+			authors, err := a.AuthorModel.ForBooks(bookIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range bookIDs {
+				included[id][include] = orEmpty(authors[id])
+			}
+		case "genres":
+			genres, err := a.genreModel.ForBooks(bookIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range bookIDs {
+				included[id][include] = orEmpty(genres[id])
+			}
+		case "series":
+			series, err := a.seriesModel.ForBooks(bookIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range bookIDs {
+				included[id][include] = series[id]
+			}
+		case "recent_reviews":
+			reviews, err := a.reviewModel.RecentForBooks(bookIDs, recentReviewsPerBook)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range bookIDs {
+				included[id][include] = orEmpty(reviews[id])
+			}
+		case "my_review":
+			reviews, err := a.reviewModel.ForBooksByUser(userID, bookIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range bookIDs {
+				included[id][include] = reviews[id]
+			}
+		case "my_lists":
+			lists, err := a.readingListModel.ForBooksByUser(userID, bookIDs)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range bookIDs {
+				included[id][include] = orEmpty(lists[id])
+			}
+		}
+	}
+
+	return included, nil
+}
+
+// includeInBooks fills in the included data of a page of books
+func (a *applicationDependencies) includeInBooks(r *http.Request, books []*data.Book, includes []string) error {
+	if len(includes) == 0 {
+		return nil
+	}
+
+	bookIDs := make([]int64, len(books))
+	for i, book := range books {
+		bookIDs[i] = book.ID
+	}
+	included, err := a.loadBookIncludes(a.contextGetUser(r).ID, bookIDs, includes)
+	if err != nil {
+		return err
+	}
+	for _, book := range books {
+		book.Included = included[book.ID]
+	}
+	return nil
+}
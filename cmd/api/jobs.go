@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// startJobs starts the periodic background jobs. They stop once ctx is
+// cancelled when the server shuts down.
+func (a *applicationDependencies) startJobs(ctx context.Context) {
+	a.runPeriodically(ctx, "trash purge", time.Hour, a.purgeTrash)
+	if a.metadata != nil && a.config.metadata.backfillInterval > 0 {
+		a.runPeriodically(ctx, "metadata backfill", a.config.metadata.backfillInterval, a.backfillMetadata)
+	}
+	if a.config.similarBooksInterval > 0 {
+		a.runPeriodically(ctx, "similar books", a.config.similarBooksInterval, a.recomputeSimilarBooks)
+	}
+	if a.config.recommendationsInterval > 0 {
+		a.runPeriodically(ctx, "recommendations", a.config.recommendationsInterval, a.recomputeRecommendations)
+	}
+	if a.config.trendingInterval > 0 {
+		a.runPeriodically(ctx, "trending refresh", a.config.trendingInterval, a.refreshTrending)
+	}
+}
+
+// runPeriodically runs fn in the background right away and then every
+// interval, until ctx is cancelled. A run that fails is logged and the
+// next one goes ahead as planned.
+func (a *applicationDependencies) runPeriodically(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	a.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			start := time.Now()
+			err := fn(ctx)
+			if err != nil && ctx.Err() == nil {
+				a.logger.Error("background job failed", "job", name, "error", err.Error())
+			} else if err == nil {
+				a.logger.Info("background job completed", "job", name, "duration", time.Since(start).String())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
@@ -12,6 +14,8 @@ import (
 
 	"github.com/georgie5/Test3-bookclubapi/internal/data"
 	"github.com/georgie5/Test3-bookclubapi/internal/mailer"
+	"github.com/georgie5/Test3-bookclubapi/internal/metadata"
+	"github.com/georgie5/Test3-bookclubapi/internal/storage"
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
  
@@ -41,6 +45,25 @@ type serverConfig struct {
 	cors struct {
         trustedOrigins []string
     }
+
+	storage struct {
+		dir string // where uploaded files such as covers are kept
+	}
+
+	trashRetention time.Duration // how long deleted books can be restored
+
+	metadata struct {
+		provider         string        // openlibrary, fixture or none
+		fixtures         string        // file read by the fixture provider
+		backfillInterval time.Duration // 0 disables the backfill job
+	}
+
+	similarBooksInterval    time.Duration // 0 disables the similar books job
+	recommendationsInterval time.Duration // 0 disables the recommendations job
+	trendingInterval        time.Duration // how often the trending figures are refreshed
+
+	grantBooksAdmin string // email of a user to make a librarian, then exit
+	repairRatings   bool   // recompute the rating aggregates of all books and exit
 }
 
 type applicationDependencies struct {
@@ -49,13 +72,25 @@ type applicationDependencies struct {
 	bookModel            *data.BookModel
 	AuthorModel          *data.AuthorModel
 	BookAuthorModel      *data.BookAuthorModel
+	genreModel           *data.GenreModel
+	tagModel             *data.TagModel
+	seriesModel          *data.SeriesModel
+	editionModel         *data.EditionModel
+	revisionModel        *data.RevisionModel
+	similarityModel      *data.SimilarityModel
+	recommendationModel  *data.RecommendationModel
+	suggestModel         data.SuggestModel
+	importJobModel       *data.ImportJobModel
 	readingListModel     *data.ReadingListModel
 	readingListBookModel *data.ReadingListBookModel
 	reviewModel          *data.ReviewModel
 	userModel            *data.UserModel
 	mailer               mailer.Mailer
+	storage              storage.Storage
+	metadata             metadata.Provider // nil when enrichment is disabled
 	wg                   sync.WaitGroup // need this later for background jobs
 	tokenModel           data.TokenModel
+	permissionModel      data.PermissionModel
 }
 
 func main() {
@@ -90,6 +125,21 @@ func main() {
    })
 
 
+	flag.StringVar(&settings.storage.dir, "storage-dir", "./uploads", "Directory for uploaded files")
+
+	flag.DurationVar(&settings.trashRetention, "trash-retention", 30*24*time.Hour, "How long deleted books are kept before they are purged")
+
+	flag.StringVar(&settings.metadata.provider, "metadata-provider", "none", "Book metadata provider (openlibrary|fixture|none)")
+	flag.StringVar(&settings.metadata.fixtures, "metadata-fixtures", "testdata/metadata/books.json", "Metadata file used by the fixture provider")
+	flag.DurationVar(&settings.metadata.backfillInterval, "metadata-backfill-interval", 24*time.Hour, "How often to fill in missing book metadata (0 to disable)")
+
+	flag.DurationVar(&settings.similarBooksInterval, "similar-books-interval", 6*time.Hour, "How often to recompute the similar books (0 to disable)")
+	flag.DurationVar(&settings.recommendationsInterval, "recommendations-interval", 6*time.Hour, "How often to recompute the rating similarities behind the recommendations (0 to disable)")
+	flag.DurationVar(&settings.trendingInterval, "trending-interval", 15*time.Minute, "How often to refresh the trending books (0 to disable)")
+
+	flag.StringVar(&settings.grantBooksAdmin, "grant-books-admin", "", "Grant the books:admin permission to the user with this email, then exit")
+	flag.BoolVar(&settings.repairRatings, "repair-ratings", false, "Recompute the rating count, sum and average of every book, then exit")
+
 	flag.Parse()
 
 	// Initialize the logger
@@ -104,6 +154,38 @@ func main() {
 	defer db.Close()
 	logger.Info("Database connection pool established")
 
+	if settings.grantBooksAdmin != "" {
+		err = grantBooksAdmin(db, settings.grantBooksAdmin)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("books:admin permission granted", "email", settings.grantBooksAdmin)
+		return
+	}
+
+	if settings.repairRatings {
+		repaired, err := (&data.BookModel{DB: db}).RepairRatings()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("book ratings repaired", "books", repaired)
+		return
+	}
+
+	fileStorage, err := storage.NewLocal(settings.storage.dir)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	metadataProvider, err := newMetadataProvider(settings)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Initialize application dependencies
 	appInstance := &applicationDependencies{
 		config:               settings,
@@ -111,12 +193,24 @@ func main() {
 		bookModel:            &data.BookModel{DB: db},
 		AuthorModel:          &data.AuthorModel{DB: db},
 		BookAuthorModel:      &data.BookAuthorModel{DB: db},
+		genreModel:           &data.GenreModel{DB: db},
+		tagModel:             &data.TagModel{DB: db},
+		seriesModel:          &data.SeriesModel{DB: db},
+		editionModel:         &data.EditionModel{DB: db},
+		revisionModel:        &data.RevisionModel{DB: db},
+		similarityModel:      &data.SimilarityModel{DB: db},
+		recommendationModel:  &data.RecommendationModel{DB: db},
+		suggestModel:         data.SuggestModel{DB: db},
+		importJobModel:       &data.ImportJobModel{DB: db},
 		readingListModel:     &data.ReadingListModel{DB: db},
 		readingListBookModel: &data.ReadingListBookModel{DB: db},
 		reviewModel:          &data.ReviewModel{DB: db},
 		userModel:            &data.UserModel{DB: db},
 		mailer:               mailer.New(settings.smtp.host, settings.smtp.port, settings.smtp.username, settings.smtp.password, settings.smtp.sender),
 		tokenModel:           data.TokenModel{DB: db},
+		permissionModel:      data.PermissionModel{DB: db},
+		storage:              fileStorage,
+		metadata:             metadataProvider,
 	}
 
 	err = appInstance.serve()
@@ -127,6 +221,33 @@ func main() {
 
 }
 
+// grantBooksAdmin makes the user with the email a librarian. Librarians
+// can not be made through the API until there is a first one.
+func grantBooksAdmin(db *sql.DB, email string) error {
+	user, err := data.UserModel{DB: db}.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("no user with the email %q", email)
+		}
+		return err
+	}
+	return data.PermissionModel{DB: db}.AddForUser(user.ID, data.PermissionBooksAdmin)
+}
+
+// newMetadataProvider sets up the configured book metadata provider
+func newMetadataProvider(settings serverConfig) (metadata.Provider, error) {
+	switch settings.metadata.provider {
+	case "openlibrary":
+		return metadata.NewOpenLibrary(), nil
+	case "fixture":
+		return metadata.NewFixture(settings.metadata.fixtures)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown metadata provider %q", settings.metadata.provider)
+	}
+}
+
 // openDB sets up a connection pool to the database
 func openDB(settings serverConfig) (*sql.DB, error) {
 	db, err := sql.Open("postgres", settings.db.dsn)
@@ -178,6 +178,30 @@ func (a *applicationDependencies) requireActivatedUser(next http.HandlerFunc) ht
 	return a.requireAuthenticatedUser(fn)
 }
 
+// This middleware checks that the (activated) user was granted the
+// permission code
+func (a *applicationDependencies) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		user := a.contextGetUser(r)
+
+		permissions, err := a.permissionModel.GetAllForUser(user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			a.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return a.requireActivatedUser(fn)
+}
+
 func (a *applicationDependencies) enableCORS (next http.Handler) http.Handler {                             
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
  
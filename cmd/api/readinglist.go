@@ -66,8 +66,16 @@ func (a *applicationDependencies) getReadingListHandler(w http.ResponseWriter, r
 		return
 	}
 
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	v := validator.New()
+	data.ValidateFields(v, fields, data.ReadingListFields)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Fetch reading list from the database
-	list, err := a.readingListModel.Get(id)
+	list, err := a.readingListModel.Get(id, fields)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -79,7 +87,7 @@ func (a *applicationDependencies) getReadingListHandler(w http.ResponseWriter, r
 	}
 
 	data := envelope{
-		"list": list,
+		"list": withFields(list, fields),
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -95,7 +103,7 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 		a.notFoundResponse(w, r)
 		return
 	}
-	list, err := a.readingListModel.Get(id)
+	list, err := a.readingListModel.Get(id, nil)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -202,6 +210,18 @@ func (a *applicationDependencies) addBookToReadingListHandler(w http.ResponseWri
 		return
 	}
 
+	// books in the trash can not be added to lists
+	_, _, err = a.bookModel.Get(incomingData.BookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	err = a.readingListBookModel.AddBook(listID, incomingData.BookID)
 	if err != nil {
 		switch {
@@ -280,7 +300,14 @@ func (a *applicationDependencies) listReadingListsHandler(w http.ResponseWriter,
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, v)
 
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	queryParametersData.Filters.SortSafeList = []string{"id", "name", "description", "created_by", "status", "-id", "-name", "-description", "-created_by", "-status"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "name", "description", "created_by", "status", "book_count",
+		"-id", "-name", "-description", "-created_by", "-status", "-book_count"}
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(query, "fields", nil)
+	queryParametersData.Filters.FieldSafeList = data.ReadingListFields
+
+	// cursors from a previous page take the place of the page number
+	queryParametersData.Filters.After = a.getSingleQueryParameter(query, "after", "")
+	queryParametersData.Filters.Before = a.getSingleQueryParameter(query, "before", "")
 
 	//validate the filters
 	data.ValidateFilters(v, queryParametersData.Filters)
@@ -296,7 +323,7 @@ func (a *applicationDependencies) listReadingListsHandler(w http.ResponseWriter,
 	}
 
 	data := envelope{
-		"lists":     lists,
+		"lists":     withFields(lists, queryParametersData.Filters.Fields),
 		"@metadata": metadata,
 	}
 
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// comparing the ratings of every pair of books is one large query
+const recommendationsTimeout = 10 * time.Minute
+
+// recommend books the user has not read yet. Recommendations are private,
+// "me" stands for the authenticated user.
+func (a *applicationDependencies) getRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	if httprouter.ParamsFromContext(r.Context()).ByName("user_id") != "me" {
+		userID, err := a.readIDParam(r, "user_id")
+		if err != nil {
+			a.notFoundResponse(w, r)
+			return
+		}
+		if userID != user.ID {
+			a.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	v := validator.New()
+	limit := a.getSingleIntegerParameter(r.URL.Query(), "limit", 10, v)
+	v.Check(limit > 0 && limit <= 50, "limit", "must be between 1 and 50")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recommendations, err := a.recommendationModel.ForUser(user.ID, limit)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"recommendations": recommendations,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// recomputeRecommendations works out how alike readers rate the books, which
+// the recommendations are predicted from
+func (a *applicationDependencies) recomputeRecommendations(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, recommendationsTimeout)
+	defer cancel()
+
+	stored, err := a.recommendationModel.RecomputeSimilarities(ctx)
+	if err != nil {
+		return err
+	}
+	a.logger.Info("rating similarities recomputed", "pairs", stored)
+	return nil
+}
@@ -44,25 +44,101 @@ func (a *applicationDependencies) addReviewHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	// books in the trash can not be reviewed
+	_, _, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	// Insert the review into the database
 	err = a.reviewModel.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			a.conflictResponse(w, r, "this user has already reviewed this book, replace the review with PUT /v1/books/:book_id/reviews/me")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Send the response with the created review
+	data := envelope{
+		"review": review,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// create or replace the review of the authenticated user for a book
+func (a *applicationDependencies) putMyReviewHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
 		return
 	}
 
-	err = a.bookModel.UpdateAverageRating(bookID)
+	var incomingData struct {
+		Rating int    `json:"rating"`
+		Review string `json:"review"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		BookID: bookID,
+		UserID: a.contextGetUser(r).ID,
+		Rating: incomingData.Rating,
+		Review: incomingData.Review,
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// books in the trash can not be reviewed
+	_, _, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	created, err := a.reviewModel.Upsert(review)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Send the response with the created review
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
 	data := envelope{
 		"review": review,
 	}
-
-	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	err = a.writeJSON(w, status, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -124,11 +200,6 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	err = a.bookModel.UpdateAverageRating(review.BookID)
-	if err != nil {
-		a.serverErrorResponse(w, r, err)
-		return
-	}
 	//Send a JSON response with the updated product
 	data := envelope{"review": review}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -145,18 +216,6 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	// Get the review from the database
-	review, err := a.reviewModel.Get(reviewID)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			a.notFoundResponse(w, r)
-		default:
-			a.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-
 	// Delete the review from the database
 	err = a.reviewModel.Delete(reviewID)
 	if err != nil {
@@ -169,12 +228,6 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	err = a.bookModel.UpdateAverageRating(review.BookID)
-	if err != nil {
-		a.serverErrorResponse(w, r, err)
-		return
-	}
-
 	// Send a confirmation response
 	data := envelope{
 		"message": "review successfully deleted",
@@ -209,7 +262,13 @@ func (a *applicationDependencies) getReviewsForBookHandler(w http.ResponseWriter
 	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, v)
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	queryParametersData.Filters.SortSafeList = []string{"id", "rating", "review", "-id", "-rating", "-review"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "rating", "review", "review_date", "-id", "-rating", "-review", "-review_date"}
+	queryParametersData.Filters.Fields = a.getMultipleQueryParameters(query, "fields", nil)
+	queryParametersData.Filters.FieldSafeList = data.ReviewFields
+
+	// cursors from a previous page take the place of the page number
+	queryParametersData.Filters.After = a.getSingleQueryParameter(query, "after", "")
+	queryParametersData.Filters.Before = a.getSingleQueryParameter(query, "before", "")
 
 	data.ValidateFilters(v, queryParametersData.Filters)
 	if !v.IsEmpty() {
@@ -225,7 +284,7 @@ func (a *applicationDependencies) getReviewsForBookHandler(w http.ResponseWriter
 	}
 
 	responseData := envelope{
-		"reviews":   reviews,
+		"reviews":   withFields(reviews, queryParametersData.Filters.Fields),
 		"@metadata": metadata,
 	}
 	err = a.writeJSON(w, http.StatusOK, responseData, nil)
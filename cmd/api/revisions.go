@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// revisionGenres looks up the genres of a revision by ID, keeping their
+// order. Genres deleted since are reported on the validator.
+func (a *applicationDependencies) revisionGenres(v *validator.Validator, ids []int64) ([]*data.Genre, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	found, err := a.genreModel.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*data.Genre, len(found))
+	for _, genre := range found {
+		byID[genre.ID] = genre
+	}
+
+	genres := make([]*data.Genre, 0, len(ids))
+	for _, id := range ids {
+		genre, ok := byID[id]
+		if !ok {
+			v.AddError("genres", fmt.Sprintf("genre %d of the revision no longer exists", id))
+			continue
+		}
+		genres = append(genres, genre)
+	}
+
+	return genres, nil
+}
+
+// list the changes made to a book
+func (a *applicationDependencies) getBookHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	v := validator.New()
+	var filters data.Filters
+	filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	filters.Sort = a.getSingleQueryParameter(query, "sort", "-id")
+	filters.SortSafeList = []string{"id", "-id"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, _, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revisions, metadata, err := a.revisionModel.GetAllForBook(bookID, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"revisions": revisions,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// put a book back into the state it had after one of its revisions. The
+// revert itself is recorded as a new revision.
+func (a *applicationDependencies) revertBookHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+	revisionID, err := a.readIDParam(r, "revision_id")
+	if err != nil || revisionID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := a.revisionModel.Get(bookID, revisionID)
+	var book *data.Book
+	if err == nil {
+		book, _, err = a.bookModel.Get(bookID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	target := revision.Snapshot
+
+	v := validator.New()
+
+	book.Title = target.Title
+	book.ISBN = target.ISBN
+	book.Description = target.Description
+	book.PublicationDate, err = time.Parse("2006-01-02", target.PublicationDate)
+	if err != nil {
+		v.AddError("publication_date", "the revision has no valid publication date")
+	}
+
+	// genres and series are looked up again, they may have been deleted
+	// since the revision was made. Revisions made before the genre IDs
+	// were recorded only have the names of the genres.
+	var genres []*data.Genre
+	if target.GenreIDs != nil {
+		genres, err = a.revisionGenres(v, target.GenreIDs)
+	} else {
+		genreNames := target.Genres
+		if len(genreNames) == 0 {
+			genreNames = []string{target.Genre}
+		}
+		genres, err = a.resolveGenres(v, genreNames)
+	}
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	book.Genre = ""
+	if len(genres) > 0 {
+		book.Genre = genres[0].Name
+	}
+	genreIDs, _ := genreIDsAndNames(genres)
+
+	var seriesID int64
+	if target.SeriesID != nil {
+		seriesID = *target.SeriesID
+	}
+	err = a.setBookSeries(v, book, &seriesID, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	book.SeriesPosition = nil
+	if book.SeriesID != nil {
+		book.SeriesPosition = target.SeriesPosition
+	}
+
+	data.ValidateBook(v, book)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tx, err := a.bookModel.Begin()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := tx.Snapshot(bookID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = tx.Update(book)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateISBN):
+			v.AddError("isbn", "another book now has the ISBN of this revision")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = tx.SetGenres(bookID, genreIDs)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !slices.Equal(before.Authors, target.Authors) {
+		err = tx.SetAuthors(bookID, target.Authors)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	user := a.contextGetUser(r)
+	reverted, err := tx.RecordRevision(bookID, &user.ID, data.RevisionRevert, before, &revision.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"revision": reverted,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
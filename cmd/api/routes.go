@@ -3,6 +3,8 @@ package main
 import (
 	"net/http"
 
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -19,11 +21,59 @@ func (a *applicationDependencies) routes() http.Handler {
 
 	//Books routes
 	router.HandlerFunc(http.MethodGet, "/api/v1/books/search", a.requireActivatedUser(a.searchBooksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/suggest", a.requireActivatedUser(a.suggestHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/books", a.requireActivatedUser(a.listBooksHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/books", a.requireActivatedUser(a.createBookHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/books/:book_id", a.requireActivatedUser(a.getBookHandler))
 	router.HandlerFunc(http.MethodPut, "/v1/books/:book_id", a.requireActivatedUser(a.updateBookHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/books/:book_id", a.requireActivatedUser(a.deleteBookHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:book_id/restore", a.requirePermission(data.PermissionBooksAdmin, a.restoreBookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/trash/books", a.requirePermission(data.PermissionBooksAdmin, a.listTrashHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:book_id/stats", a.requireActivatedUser(a.getBookStatsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:book_id/similar", a.requireActivatedUser(a.getSimilarBooksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:book_id/history", a.requireActivatedUser(a.getBookHistoryHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:book_id/history/:revision_id/revert", a.requirePermission(data.PermissionBooksAdmin, a.revertBookHandler))
+	// covers are served without authentication so they can be used in <img> tags
+	router.HandlerFunc(http.MethodGet, "/v1/books/:book_id/cover", a.serveBookCoverHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/books/:book_id/cover", a.requireActivatedUser(a.uploadBookCoverHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/imports/:import_id", a.requireActivatedUser(a.getImportJobHandler))
+
+	// Actions on the whole catalogue, kept apart from /v1/books/:book_id
+	// which httprouter does not let fixed segments share
+	router.HandlerFunc(http.MethodGet, "/v1/catalog/export", a.requireActivatedUser(a.exportBooksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/catalog/trending", a.requireActivatedUser(a.trendingBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/catalog/import", a.requireActivatedUser(a.importBooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/catalog/enrich", a.requireActivatedUser(a.enrichBookHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/catalog/batch", a.requirePermission(data.PermissionBooksAdmin, a.batchBooksHandler))
+
+	// Works and editions routes, a work is a book in the routes above
+	router.HandlerFunc(http.MethodGet, "/v1/works", a.requireActivatedUser(a.listWorksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/works/:work_id", a.requireActivatedUser(a.getWorkHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/editions", a.requireActivatedUser(a.listEditionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/editions", a.requireActivatedUser(a.createEditionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/editions/:edition_id", a.requireActivatedUser(a.getEditionHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/editions/:edition_id", a.requireActivatedUser(a.updateEditionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/editions/:edition_id", a.requireActivatedUser(a.deleteEditionHandler))
+
+	// Tags routes
+	router.HandlerFunc(http.MethodGet, "/v1/tags", a.requireActivatedUser(a.tagCloudHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/books/:book_id/tags", a.requireActivatedUser(a.getBookTagsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/books/:book_id/tags", a.requireActivatedUser(a.addBookTagsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/books/:book_id/tags/:tag", a.requireActivatedUser(a.removeBookTagHandler))
+
+	// Genres routes
+	router.HandlerFunc(http.MethodGet, "/v1/genres", a.requireActivatedUser(a.listGenresHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", a.requirePermission(data.PermissionBooksAdmin, a.createGenreHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:genre_id", a.requireActivatedUser(a.getGenreHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/genres/:genre_id", a.requirePermission(data.PermissionBooksAdmin, a.updateGenreHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:genre_id", a.requirePermission(data.PermissionBooksAdmin, a.deleteGenreHandler))
+
+	// Series routes
+	router.HandlerFunc(http.MethodGet, "/v1/series", a.requireActivatedUser(a.listSeriesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/series", a.requireActivatedUser(a.createSeriesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/series/:series_id", a.requireActivatedUser(a.getSeriesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/series/:series_id", a.requireActivatedUser(a.updateSeriesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/series/:series_id", a.requireActivatedUser(a.deleteSeriesHandler))
 
 	// Reading lists routes
 	router.HandlerFunc(http.MethodGet, "/api/v1/lists", a.requireActivatedUser(a.listReadingListsHandler))
@@ -33,10 +83,12 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:list_id", a.requireActivatedUser(a.deleteReadingListHandler))
 	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:list_id/books", a.requireActivatedUser(a.addBookToReadingListHandler))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:list_id/books", a.requireActivatedUser(a.removeBookFromReadingListHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:list_id/books/batch", a.requireActivatedUser(a.batchReadingListBooksHandler))
 																				
 	// Reviews routes
 	router.HandlerFunc(http.MethodGet, "/v1/books/:book_id/reviews", a.requireActivatedUser(a.getReviewsForBookHandler)) // Get reviews for a specific book
 	router.HandlerFunc(http.MethodPost, "/v1/books/:book_id/reviews", a.requireActivatedUser(a.addReviewHandler))        // Add a new review to a specific book
+	router.HandlerFunc(http.MethodPut, "/v1/books/:book_id/reviews/me", a.requireActivatedUser(a.putMyReviewHandler))    // Create or replace your review of a book
 	router.HandlerFunc(http.MethodPut, "/v1/reviews/:review_id", a.requireActivatedUser(a.updateReviewHandler))          // Update a review
 	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:review_id", a.requireActivatedUser(a.deleteReviewHandler))       // Delete a review
 
@@ -45,6 +97,7 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id",  a.requireActivatedUser(a.getUserProfileHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/lists",  a.requireActivatedUser(a.getUserReadingListsHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/reviews",  a.requireActivatedUser(a.getUserReviewsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/recommendations", a.requireActivatedUser(a.getRecommendationsHandler))
 
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", a.activateUserHandler)
 
@@ -57,4 +110,3 @@ func (a *applicationDependencies) routes() http.Handler {
 	return a.recoverPanic(a.enableCORS(a.rateLimit(a.authenticate(router))))
 
 }
-
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+func (a *applicationDependencies) createSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	series := &data.Series{
+		Name:        incomingData.Name,
+		Description: incomingData.Description,
+	}
+
+	v := validator.New()
+	data.ValidateSeries(v, series)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.seriesModel.Insert(series)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/series/%d", series.ID))
+
+	data := envelope{
+		"series": series,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// get a series along with its books in reading order
+func (a *applicationDependencies) getSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "series_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	series, err := a.seriesModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	books, err := a.seriesModel.Books(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"series": series,
+		"books":  books,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) updateSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "series_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	series, err := a.seriesModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var incomingData struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Name != nil {
+		series.Name = *incomingData.Name
+	}
+	if incomingData.Description != nil {
+		series.Description = *incomingData.Description
+	}
+
+	v := validator.New()
+	data.ValidateSeries(v, series)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.seriesModel.Update(series)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"series": series,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "series_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	err = a.seriesModel.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "series successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		Name string
+		data.Filters
+	}
+
+	query := r.URL.Query()
+	queryParametersData.Name = a.getSingleQueryParameter(query, "name", "")
+
+	v := validator.New()
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "name")
+	queryParametersData.Filters.SortSafeList = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	series, metadata, err := a.seriesModel.GetAll(queryParametersData.Name, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"series":    series,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -23,6 +23,11 @@ func (a *applicationDependencies) serve() error {
 		ErrorLog:     slog.NewLogLogger(a.logger.Handler(), slog.LevelError),
 	}
 
+	// the periodic jobs run until the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	a.startJobs(jobsCtx)
+
 	// create a channel to keep track of any errors during the shutdown process
 	shutdownError := make(chan error)
 	// create a goroutine that runs in the background listening
@@ -44,6 +49,7 @@ func (a *applicationDependencies) serve() error {
 		}
 		// Wait for background tasks to complete
 		a.logger.Info("completing background tasks", "address", apiServer.Addr)
+		stopJobs()
 		a.wg.Wait()
 		shutdownError <- nil
 
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// scoring the whole catalogue is one large query
+const similarBooksTimeout = 10 * time.Minute
+
+// list the books most similar to a book
+func (a *applicationDependencies) getSimilarBooksHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	limit := a.getSingleIntegerParameter(r.URL.Query(), "limit", 10, v)
+	v.Check(limit > 0 && limit <= data.MaxSimilarBooks, "limit", "must be between 1 and 20")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, _, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	books, err := a.similarityModel.ForBook(bookID, limit)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// books added since the last run of the job are scored on the spot.
+	// A book that was scored and has nothing in common with the rest
+	// waits for the next run.
+	if len(books) == 0 {
+		scored, err := a.similarityModel.Scored(bookID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if !scored {
+			_, err = a.similarityModel.Recompute(r.Context(), bookID)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			books, err = a.similarityModel.ForBook(bookID, limit)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	data := envelope{
+		"books": books,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// recomputeSimilarBooks scores the similar books of the whole catalogue
+func (a *applicationDependencies) recomputeSimilarBooks(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, similarBooksTimeout)
+	defer cancel()
+
+	stored, err := a.similarityModel.Recompute(ctx, 0)
+	if err != nil {
+		return err
+	}
+	a.logger.Info("similar books recomputed", "pairs", stored)
+	return nil
+}
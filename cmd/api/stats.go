@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+)
+
+// get the rating distribution and review statistics of a book
+func (a *applicationDependencies) getBookStatsHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	book, _, err := a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	stats, err := a.bookModel.Stats(bookID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	stats.AverageRating = book.AverageRating
+
+	data := envelope{
+		"stats": stats,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
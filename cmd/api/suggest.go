@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// suggest books, authors and series as the user types
+func (a *applicationDependencies) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	text := strings.TrimSpace(a.getSingleQueryParameter(query, "q", ""))
+
+	v := validator.New()
+	limit := a.getSingleIntegerParameter(query, "limit", 5, v)
+	v.Check(utf8.RuneCountInString(text) >= 2, "q", "must be at least 2 characters long")
+	v.Check(len(text) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0 && limit <= 10, "limit", "must be between 1 and 10")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := a.suggestModel.Suggest(text, limit)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"suggestions": suggestions,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// get the tags on a book along with how many members used each one
+func (a *applicationDependencies) getBookTagsHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	_, _, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := a.contextGetUser(r)
+	tags, err := a.tagModel.ForBook(bookID, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"tags": tags,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// tag a book on behalf of the current user
+func (a *applicationDependencies) addBookTagsHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Tags []string `json:"tags"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTags(v, incomingData.Tags)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, _, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := a.contextGetUser(r)
+	err = a.tagModel.AddToBook(bookID, user.ID, incomingData.Tags)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tags, err := a.tagModel.ForBook(bookID, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"tags": tags,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// remove one of the current user's tags from a book
+func (a *applicationDependencies) removeBookTagHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r, "book_id")
+	if err != nil || bookID < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+	tag := params.ByName("tag")
+
+	user := a.contextGetUser(r)
+	err = a.tagModel.RemoveFromBook(bookID, user.ID, tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "tag successfully removed from book",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// the tag cloud: every tag with the number of books it was put on
+func (a *applicationDependencies) tagCloudHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	v := validator.New()
+	limit := a.getSingleIntegerParameter(query, "limit", 50, v)
+	mine := a.getSingleQueryParameter(query, "mine", "false")
+
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 500, "limit", "must be a maximum of 500")
+	v.Check(validator.PermittedValue(mine, "true", "false"), "mine", "must be either 'true' or 'false'")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// only count the current user's tags when asked to
+	var userID int64
+	if mine == "true" {
+		userID = a.contextGetUser(r).ID
+	}
+
+	tags, err := a.tagModel.Cloud(userID, limit)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"tags": tags,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
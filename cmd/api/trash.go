@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// list the deleted books that can still be restored
+func (a *applicationDependencies) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		Title string
+		data.Filters
+	}
+
+	query := r.URL.Query()
+	queryParametersData.Title = a.getSingleQueryParameter(query, "title", "")
+
+	v := validator.New()
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "-deleted_at")
+	queryParametersData.Filters.SortSafeList = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.bookModel.GetTrash(queryParametersData.Title, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"books":     books,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// take a book out of the trash
+func (a *applicationDependencies) restoreBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "book_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user := a.contextGetUser(r)
+	err = a.bookModel.Restore(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "book successfully restored",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash permanently deletes the books that were in the trash for
+// longer than the retention period, along with their cover images
+func (a *applicationDependencies) purgeTrash(ctx context.Context) error {
+	ids, err := a.bookModel.Purge(a.config.trashRetention)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := a.storage.Delete(coverPrefix(id))
+		if err != nil {
+			a.logger.Error("unable to delete cover", "book_id", id, "error", err.Error())
+		}
+	}
+
+	if len(ids) > 0 {
+		a.logger.Info("purged deleted books", "count", len(ids))
+	}
+	return nil
+}
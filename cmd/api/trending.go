@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// list the books trending over the last week, month or year
+func (a *applicationDependencies) trendingBooksHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	v := validator.New()
+	criteria := data.TrendingCriteria{
+		Window:     a.getSingleQueryParameter(query, "window", "7d"),
+		Metric:     a.getSingleQueryParameter(query, "metric", "added"),
+		MinReviews: a.getSingleIntegerParameter(query, "min_reviews", 3, v),
+		Limit:      a.getSingleIntegerParameter(query, "limit", 10, v),
+	}
+
+	data.ValidateTrendingCriteria(v, criteria)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, refreshedAt, err := a.bookModel.Trending(criteria)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"books":  books,
+		"window": criteria.Window,
+		"metric": criteria.Metric,
+	}
+	if !refreshedAt.IsZero() {
+		data["refreshed_at"] = refreshedAt
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshTrending recomputes the figures behind the trending leaderboards
+func (a *applicationDependencies) refreshTrending(ctx context.Context) error {
+	return a.bookModel.RefreshTrending(ctx)
+}
@@ -160,8 +160,17 @@ func (a *applicationDependencies) getUserProfileHandler(w http.ResponseWriter, r
 		return
 	}
 
+	// only the fields asked for are read and sent
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	v := validator.New()
+	data.ValidateFields(v, fields, data.UserFields)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Fetch the user from the database
-	user, err := a.userModel.GetUser(userID)
+	user, err := a.userModel.GetUser(userID, fields)
 	if err != nil {
 		switch err {
 		case data.ErrRecordNotFound:
@@ -174,7 +183,7 @@ func (a *applicationDependencies) getUserProfileHandler(w http.ResponseWriter, r
 
 	// Prepare and send the response
 	data := envelope{
-		"user": user,
+		"user": withFields(user, fields),
 	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -191,8 +200,16 @@ func (a *applicationDependencies) getUserReadingListsHandler(w http.ResponseWrit
 		return
 	}
 
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	v := validator.New()
+	data.ValidateFields(v, fields, data.ReadingListFields)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Fetch the user's reading lists from the database
-	lists, err := a.userModel.GetLists(userID)
+	lists, err := a.userModel.GetLists(userID, fields)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -200,7 +217,7 @@ func (a *applicationDependencies) getUserReadingListsHandler(w http.ResponseWrit
 
 	// Prepare and send the response
 	data := envelope{
-		"lists": lists,
+		"lists": withFields(lists, fields),
 	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -217,8 +234,16 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 		return
 	}
 
+	fields := a.getMultipleQueryParameters(r.URL.Query(), "fields", nil)
+	v := validator.New()
+	data.ValidateFields(v, fields, data.ReviewFields)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Fetch the user's reviews from the database
-	reviews, err := a.userModel.GetReviews(userID)
+	reviews, err := a.userModel.GetReviews(userID, fields)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -226,7 +251,7 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
 
 	// Prepare and send the response
 	data := envelope{
-		"reviews": reviews,
+		"reviews": withFields(reviews, fields),
 	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/data"
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// a work is a book as written, its reviews and ratings cover all of its
+// editions
+type workResponse struct {
+	ID            int64               `json:"id"`
+	Title         string              `json:"title"`
+	Authors       []string            `json:"authors"`
+	Genre         string              `json:"genre"`
+	Genres        []string            `json:"genres"`
+	Description   string              `json:"description"`
+	AverageRating float64             `json:"average_rating"`
+	ReviewCount   int                 `json:"review_count"`
+	CoverURL      string              `json:"cover_url,omitempty"`
+	Series        *bookSeriesResponse `json:"series,omitempty"`
+	Editions      []*data.Edition     `json:"editions"`
+	Included      map[string]any      `json:"included,omitempty"`
+	Version       int32               `json:"version"`
+}
+
+// list the works, which takes the same filters and sorts as the books
+func (a *applicationDependencies) listWorksHandler(w http.ResponseWriter, r *http.Request) {
+	a.listBooks(w, r, "works")
+}
+
+// display a work with all of its editions
+func (a *applicationDependencies) getWorkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "work_id")
+	if err != nil || id < 1 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	includes := a.readBookIncludes(r.URL.Query(), v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, authors, err := a.bookModel.Get(id)
+	if err != nil {
+		switch err {
+		case data.ErrRecordNotFound:
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	genres, err := a.genreModel.ForBook(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	_, genreNames := genreIDsAndNames(genres)
+
+	editions, err := a.editionModel.ForWork(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authorNames := make([]string, len(authors))
+	for i, author := range authors {
+		authorNames[i] = author.Name
+	}
+
+	var included map[int64]map[string]any
+	if len(includes) > 0 {
+		included, err = a.loadBookIncludes(a.contextGetUser(r).ID, []int64{id}, includes)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"work": workResponse{
+			ID:            book.ID,
+			Title:         book.Title,
+			Authors:       authorNames,
+			Genre:         book.Genre,
+			Genres:        genreNames,
+			Description:   book.Description,
+			AverageRating: book.AverageRating,
+			ReviewCount:   book.ReviewCount,
+			CoverURL:      coverURL(book),
+			Series:        bookSeries(book),
+			Editions:      editions,
+			Included:      included[id],
+			Version:       book.Version,
+		},
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
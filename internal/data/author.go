@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/lib/pq"
 )
 
 // Author represents an author of a book.
@@ -65,3 +66,39 @@ func (m *AuthorModel) Get(name string) (*Author, error) {
 
 	return &author, nil
 }
+
+// ForBooks returns the authors of each of the books, by book ID, in one query
+func (m *AuthorModel) ForBooks(bookIDs []int64) (map[int64][]*Author, error) {
+	query := `
+		SELECT ba.book_id, a.id, a.name
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = ANY($1)
+		ORDER BY ba.book_id, a.name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(bookIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := make(map[int64][]*Author, len(bookIDs))
+	for rows.Next() {
+		var bookID int64
+		var author Author
+		err := rows.Scan(&bookID, &author.ID, &author.Name)
+		if err != nil {
+			return nil, err
+		}
+		authors[bookID] = append(authors[bookID], &author)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return authors, nil
+}
@@ -0,0 +1,291 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// MaxBatchItems limits how many items a batch request can hold
+const MaxBatchItems = 100
+
+// Batch actions and the outcomes of their items. The outcomes after
+// BatchNotFound are failures, which roll back an all-or-nothing batch.
+const (
+	BatchAdd    = "add"
+	BatchRemove = "remove"
+	BatchDelete = "delete"
+	BatchUpdate = "update"
+
+	BatchAdded         = "added"
+	BatchAlreadyListed = "already_listed"
+	BatchRemoved       = "removed"
+	BatchNotListed     = "not_listed"
+	BatchDeleted       = "deleted"
+	BatchUpdated       = "updated"
+	BatchNotFound      = "not_found"
+	BatchInvalid       = "invalid"
+	BatchConflict      = "edit_conflict"
+	BatchDuplicateISBN = "duplicate_isbn"
+)
+
+// BatchResult is the outcome of one item of a batch
+type BatchResult struct {
+	ID     int64             `json:"id"`
+	Action string            `json:"action"`
+	Status string            `json:"status"`
+	Errors map[string]string `json:"errors,omitempty"` // why an invalid item was rejected
+}
+
+// Failed reports whether the item could not be carried out
+func (r *BatchResult) Failed() bool {
+	switch r.Status {
+	case BatchNotFound, BatchInvalid, BatchConflict, BatchDuplicateISBN:
+		return true
+	}
+	return false
+}
+
+// batchFailed reports whether any item of a batch failed
+func batchFailed(results []*BatchResult) bool {
+	for _, result := range results {
+		if result.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateBatchSize checks that a batch is not empty nor too large
+func ValidateBatchSize(v *validator.Validator, size int) {
+	v.Check(size > 0, "items", "must contain at least one item")
+	v.Check(size <= MaxBatchItems, "items", fmt.Sprintf("must not contain more than %d items", MaxBatchItems))
+}
+
+// Batch adds books to and removes books from a reading list in one
+// transaction. Books in the trash can not be added. All-or-nothing batches
+// are rolled back when any item fails. The results follow the order of the
+// items, additions first, and committed tells whether they were saved.
+func (m *ReadingListBookModel) Batch(listID int64, add, remove []int64, allOrNothing bool) (results []*BatchResult, committed bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	for _, bookID := range add {
+		result := &BatchResult{ID: bookID, Action: BatchAdd}
+		results = append(results, result)
+
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)`, bookID).Scan(&exists)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			result.Status = BatchNotFound
+			continue
+		}
+
+		query := `
+			INSERT INTO reading_lists_books (reading_list_id, book_id)
+			VALUES ($1, $2)
+			ON CONFLICT (reading_list_id, book_id) DO NOTHING
+		`
+		added, err := execCount(ctx, tx, query, listID, bookID)
+		if err != nil {
+			return nil, false, err
+		}
+		result.Status = BatchAdded
+		if added == 0 {
+			result.Status = BatchAlreadyListed
+		}
+	}
+
+	for _, bookID := range remove {
+		result := &BatchResult{ID: bookID, Action: BatchRemove}
+		results = append(results, result)
+
+		query := `
+			DELETE FROM reading_lists_books
+			WHERE reading_list_id = $1 AND book_id = $2
+		`
+		removed, err := execCount(ctx, tx, query, listID, bookID)
+		if err != nil {
+			return nil, false, err
+		}
+		result.Status = BatchRemoved
+		if removed == 0 {
+			result.Status = BatchNotListed
+		}
+	}
+
+	if allOrNothing && batchFailed(results) {
+		return results, false, nil
+	}
+	return results, true, tx.Commit()
+}
+
+// BookPatch holds the changes a bulk update makes to a book. Nil fields are
+// left unchanged, and a nil Version skips the edit conflict check.
+type BookPatch struct {
+	Title           *string
+	ISBN            *string
+	PublicationDate *time.Time
+	Description     *string
+	Version         *int32
+}
+
+// ValidateBookPatch validates the fields a bulk update changes
+func ValidateBookPatch(v *validator.Validator, p *BookPatch) {
+	if p.Title != nil {
+		v.Check(*p.Title != "", "title", "must be provided")
+	}
+	if p.ISBN != nil {
+		v.Check(*p.ISBN != "", "isbn", "must be provided")
+	}
+	if p.PublicationDate != nil {
+		v.Check(!p.PublicationDate.IsZero(), "publication_date", "must be provided")
+	}
+	if p.Description != nil {
+		v.Check(*p.Description != "", "description", "must be provided")
+	}
+}
+
+// BookBatchItem is a book to delete or update in a bulk operation. Items
+// that failed validation carry their errors and are not carried out.
+type BookBatchItem struct {
+	ID     int64
+	Action string // BatchDelete or BatchUpdate
+	Patch  *BookPatch
+	Errors map[string]string
+}
+
+// Batch moves books to the trash and updates books in one transaction,
+// recording each change as a revision made by the user. Each update runs
+// in a savepoint so an ISBN clash only fails its own item. All-or-nothing
+// batches are rolled back when any item fails. The results follow the
+// order of the items, and committed tells whether they were saved.
+func (m BookModel) Batch(items []*BookBatchItem, allOrNothing bool, userID int64) (results []*BatchResult, committed bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		result := &BatchResult{ID: item.ID, Action: item.Action}
+		results = append(results, result)
+
+		if len(item.Errors) > 0 {
+			result.Status = BatchInvalid
+			result.Errors = item.Errors
+			continue
+		}
+
+		switch item.Action {
+		case BatchDelete:
+			deleted, err := trashBook(ctx, tx, item.ID, userID)
+			if err != nil {
+				return nil, false, err
+			}
+			result.Status = BatchDeleted
+			if !deleted {
+				result.Status = BatchNotFound
+			}
+		case BatchUpdate:
+			before, _, err := bookSnapshot(ctx, tx, item.ID)
+			if errors.Is(err, ErrRecordNotFound) {
+				result.Status = BatchNotFound
+				continue
+			}
+			if err != nil {
+				return nil, false, err
+			}
+
+			result.Status, err = updateBookPatch(ctx, tx, item.ID, item.Patch)
+			if err != nil {
+				return nil, false, err
+			}
+			if result.Status == BatchUpdated {
+				_, err = recordBookRevision(ctx, tx, item.ID, &userID, RevisionUpdate, before, nil)
+				if err != nil {
+					return nil, false, err
+				}
+			}
+		}
+	}
+
+	if allOrNothing && batchFailed(results) {
+		return results, false, nil
+	}
+	return results, true, tx.Commit()
+}
+
+// updateBookPatch applies a bulk update to a book and returns the outcome
+func updateBookPatch(ctx context.Context, tx *sql.Tx, id int64, p *BookPatch) (string, error) {
+	_, err := tx.ExecContext(ctx, `SAVEPOINT book_patch`)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		UPDATE books
+		SET title = COALESCE($2, title), isbn = COALESCE($3, isbn),
+			publication_date = COALESCE($4, publication_date), description = COALESCE($5, description),
+			version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		AND (version = $6 OR $6 IS NULL)
+		RETURNING version
+	`
+	var version int32
+	err = tx.QueryRowContext(ctx, query, id, p.Title, p.ISBN, p.PublicationDate, p.Description, p.Version).Scan(&version)
+	if err != nil {
+		_, rollbackErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT book_patch`)
+		if rollbackErr != nil {
+			return "", rollbackErr
+		}
+
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn_key"`,
+			err.Error() == `pq: duplicate key value violates unique constraint "editions_isbn_key"`:
+			return BatchDuplicateISBN, nil
+		case errors.Is(err, sql.ErrNoRows):
+			// the book is gone, or was changed since the client read it
+			var exists bool
+			err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
+			if err != nil {
+				return "", err
+			}
+			if !exists {
+				return BatchNotFound, nil
+			}
+			return BatchConflict, nil
+		default:
+			return "", err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT book_patch`)
+	return BatchUpdated, err
+}
+
+// execCount runs a statement in a transaction and returns how many rows it
+// affected
+func execCount(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,330 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx, so the queries that make
+// up a change to a book can run on their own or inside a transaction
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// BookTx is a change to a book made in a single transaction, so the book,
+// its genres, its authors and the revision recording the change are saved
+// together or not at all. Rollback must always be deferred, it is a no-op
+// after Commit.
+type BookTx struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	tx     *sql.Tx
+}
+
+// Begin starts a change to a book
+func (m BookModel) Begin() (*BookTx, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &BookTx{ctx: ctx, cancel: cancel, tx: tx}, nil
+}
+
+// Commit saves the change
+func (t *BookTx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback discards the change, unless it was committed
+func (t *BookTx) Rollback() error {
+	defer t.cancel()
+
+	err := t.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+// Insert inserts a new book
+func (t *BookTx) Insert(book *Book) error {
+	return insertBook(t.ctx, t.tx, book)
+}
+
+// Update updates a book that is not in the trash
+func (t *BookTx) Update(book *Book) error {
+	return updateBook(t.ctx, t.tx, book)
+}
+
+// SetCover records a newly uploaded cover of the given content type
+func (t *BookTx) SetCover(book *Book, contentType string) error {
+	return setBookCover(t.ctx, t.tx, book, contentType)
+}
+
+// Snapshot captures the current state of a book, to be passed to
+// RecordRevision once the book has been changed. The book stays locked
+// until the end of the transaction.
+func (t *BookTx) Snapshot(bookID int64) (*BookSnapshot, error) {
+	snapshot, _, err := bookSnapshot(t.ctx, t.tx, bookID)
+	return snapshot, err
+}
+
+// SetGenres replaces the genres of a book
+func (t *BookTx) SetGenres(bookID int64, genreIDs []int64) error {
+	return setBookGenres(t.ctx, t.tx, bookID, genreIDs)
+}
+
+// SetAuthors replaces the authors of a book by name, creating the authors
+// that are not in the database yet
+func (t *BookTx) SetAuthors(bookID int64, names []string) error {
+	_, err := t.tx.ExecContext(t.ctx, `DELETE FROM book_authors WHERE book_id = $1`, bookID)
+	if err != nil {
+		return fmt.Errorf("unable to delete book-author relationships: %w", err)
+	}
+
+	for _, name := range names {
+		var authorID int64
+		err := t.tx.QueryRowContext(t.ctx, `SELECT id FROM authors WHERE name = $1 ORDER BY id LIMIT 1`, name).Scan(&authorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = t.tx.QueryRowContext(t.ctx, `INSERT INTO authors (name) VALUES ($1) RETURNING id`, name).Scan(&authorID)
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO book_authors (book_id, author_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`
+		_, err = t.tx.ExecContext(t.ctx, query, bookID, authorID)
+		if err != nil {
+			return fmt.Errorf("unable to insert book-author relationship: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordRevision stores a revision with the changes made to a book since
+// the before snapshot, see recordBookRevision
+func (t *BookTx) RecordRevision(bookID int64, userID *int64, action string, before *BookSnapshot, revertedFrom *int64) (*BookRevision, error) {
+	return recordBookRevision(t.ctx, t.tx, bookID, userID, action, before, revertedFrom)
+}
+
+// insertBook inserts a new book and fills in its ID and version. The rating
+// aggregates are left to the database, which keeps them in line with the
+// reviews.
+func insertBook(ctx context.Context, q dbtx, book *Book) error {
+	query := `
+		INSERT INTO books (title, isbn, publication_date, genre, description, series_id, series_position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, version
+		`
+	args := []any{book.Title, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.SeriesID, book.SeriesPosition}
+
+	// Insert and retrieve the new book ID and version
+	err := q.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn_key"`:
+			return ErrDuplicateISBN
+		case err.Error() == `pq: duplicate key value violates unique constraint "editions_isbn_key"`:
+			return ErrDuplicateISBN
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// updateBook updates a book that is not in the trash and fills in its new
+// version. The rating aggregates are left to the database, see insertBook.
+func updateBook(ctx context.Context, q dbtx, book *Book) error {
+	query := `
+		UPDATE books
+		SET title = $1, isbn = $2, publication_date = $3, genre = $4, description = $5,
+			series_id = $6, series_position = $7, version = version + 1
+		WHERE id = $8 AND deleted_at IS NULL
+		RETURNING version
+		`
+	args := []any{book.Title, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.SeriesID, book.SeriesPosition, book.ID}
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "books_isbn_key"`:
+			return ErrDuplicateISBN
+		case err.Error() == `pq: duplicate key value violates unique constraint "editions_isbn_key"`:
+			return ErrDuplicateISBN
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// setBookCover records a new cover for a book that is not in the trash
+func setBookCover(ctx context.Context, q dbtx, book *Book, contentType string) error {
+	query := `
+		UPDATE books
+		SET cover_content_type = $1, cover_updated_at = NOW(), cover_version = cover_version + 1
+		WHERE id = $2 AND deleted_at IS NULL
+		RETURNING cover_content_type, cover_updated_at, cover_version
+		`
+	err := q.QueryRowContext(ctx, query, contentType, book.ID).Scan(&book.CoverContentType, &book.CoverUpdatedAt, &book.CoverVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// setBookGenres replaces the genres of a book
+func setBookGenres(ctx context.Context, q dbtx, bookID int64, genreIDs []int64) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM book_genres WHERE book_id = $1`, bookID)
+	if err != nil {
+		return fmt.Errorf("unable to delete book-genre relationships: %w", err)
+	}
+
+	query := `
+		INSERT INTO book_genres (book_id, genre_id)
+		SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING
+	`
+	_, err = q.ExecContext(ctx, query, bookID, pq.Array(genreIDs))
+	if err != nil {
+		return fmt.Errorf("unable to insert book-genre relationships: %w", err)
+	}
+	return nil
+}
+
+// bookSnapshot captures the current editable state of a book, books in the
+// trash included, along with the version of the book. The book row is
+// locked so that, inside a transaction, no other change can slip in
+// between the snapshots a revision is made from.
+func bookSnapshot(ctx context.Context, q dbtx, bookID int64) (*BookSnapshot, int32, error) {
+	query := `
+		SELECT b.title, b.isbn, b.publication_date, b.genre, b.description, b.series_id, b.series_position,
+			b.cover_version, b.version,
+			ARRAY(
+				SELECT DISTINCT a.name
+				FROM book_authors ba
+				JOIN authors a ON a.id = ba.author_id
+				WHERE ba.book_id = b.id
+			),
+			ARRAY(
+				SELECT g.name
+				FROM book_genres bg
+				JOIN genres g ON g.id = bg.genre_id
+				WHERE bg.book_id = b.id
+				ORDER BY g.name = b.genre DESC, g.name
+			),
+			ARRAY(
+				SELECT g.id
+				FROM book_genres bg
+				JOIN genres g ON g.id = bg.genre_id
+				WHERE bg.book_id = b.id
+				ORDER BY g.name = b.genre DESC, g.name
+			)
+		FROM books b
+		WHERE b.id = $1
+		FOR UPDATE OF b
+	`
+	var snapshot BookSnapshot
+	var publicationDate time.Time
+	var version int32
+
+	err := q.QueryRowContext(ctx, query, bookID).Scan(
+		&snapshot.Title,
+		&snapshot.ISBN,
+		&publicationDate,
+		&snapshot.Genre,
+		&snapshot.Description,
+		&snapshot.SeriesID,
+		&snapshot.SeriesPosition,
+		&snapshot.CoverVersion,
+		&version,
+		pq.Array(&snapshot.Authors),
+		pq.Array(&snapshot.Genres),
+		pq.Array(&snapshot.GenreIDs),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, 0, ErrRecordNotFound
+		default:
+			return nil, 0, err
+		}
+	}
+
+	snapshot.PublicationDate = publicationDate.Format("2006-01-02")
+	// sorted here rather than in SQL so the order does not depend on the
+	// collation of the database
+	slices.Sort(snapshot.Authors)
+	if snapshot.Authors == nil {
+		snapshot.Authors = []string{}
+	}
+	if snapshot.Genres == nil {
+		snapshot.Genres = []string{}
+	}
+	if snapshot.GenreIDs == nil {
+		snapshot.GenreIDs = []int64{}
+	}
+
+	return &snapshot, version, nil
+}
+
+// recordBookRevision stores a revision with the changes made to a book
+// since the before snapshot, which is nil for a new book. Updates that did
+// not change anything are not recorded. A nil userID marks a change made
+// by the system.
+func recordBookRevision(ctx context.Context, q dbtx, bookID int64, userID *int64, action string, before *BookSnapshot, revertedFrom *int64) (*BookRevision, error) {
+	after, version, err := bookSnapshot(ctx, q, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := DiffBookSnapshots(before, after)
+	if err != nil {
+		return nil, err
+	}
+	if action == RevisionUpdate && len(changes) == 0 {
+		return nil, nil
+	}
+	// a new book has no previous values to show
+	if action == RevisionCreate {
+		changes = map[string]FieldChange{}
+	}
+
+	revision := &BookRevision{
+		BookID:       bookID,
+		BookVersion:  version,
+		UserID:       userID,
+		Action:       action,
+		Changes:      changes,
+		Snapshot:     after,
+		RevertedFrom: revertedFrom,
+	}
+	err = insertRevision(ctx, q, revision)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
@@ -3,10 +3,12 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/lib/pq"
 )
 
 // bookModel wraps the database connection pool
@@ -23,7 +25,132 @@ type Book struct {
 	Genre           string    `json:"genre"`
 	Description     string    `json:"description"`
 	AverageRating   float64   `json:"average_rating"`
-	Version         int32     `json:"version"` // incremented on each update
+	ReviewCount     int       `json:"review_count"` // filled in by Get and the listings
+	Version         int32     `json:"version"`      // incremented on each update
+	// the uploaded cover, empty and nil when the book has none
+	CoverContentType string     `json:"-"`
+	CoverUpdatedAt   *time.Time `json:"-"`
+	CoverVersion     int32      `json:"-"` // incremented on each upload
+	// the series the book belongs to, nil when it stands alone. The
+	// name is only filled in by Get.
+	SeriesID       *int64   `json:"-"`
+	SeriesName     string   `json:"-"`
+	SeriesPosition *float64 `json:"-"`
+	// the related data asked for with include=, by name. Filled in by the
+	// handlers.
+	Included map[string]any `json:"included,omitempty"`
+}
+
+// BookCriteria holds the filters a client can narrow a book listing or
+// search down with. Empty fields are ignored.
+type BookCriteria struct {
+	Query  string // full-text query in websearch_to_tsquery syntax
+	Title  string
+	Author string
+	Genre  string // name or slug, books in descendant genres also match
+	// books tagged with any (or all, when TagMatch is "all") of the tags
+	Tags     []string
+	TagMatch string
+	// publication date and average rating ranges, both ends included
+	PublishedAfter  *time.Time
+	PublishedBefore *time.Time
+	MinRating       *float64
+	MaxRating       *float64
+	ISBN            string // exact match, of any edition
+	AuthorID        int64
+	HasReviews      *bool
+	// books on, or not on, the reading list with this ID
+	InList    int64
+	NotInList int64
+	// also match titles and author names that are spelled a little
+	// differently than the query, title or author
+	Fuzzy bool
+}
+
+// ValidateBookCriteria validates the filters of a book listing
+func ValidateBookCriteria(v *validator.Validator, c BookCriteria) {
+	v.Check(validator.PermittedValue(c.TagMatch, "any", "all"), "tags_match", "must be either 'any' or 'all'")
+	v.Check(len(c.Tags) <= 20, "tags", "must not contain more than 20 tags")
+	for _, tag := range c.Tags {
+		v.Check(Slugify(tag) != "", "tags", "must contain at least one letter or digit")
+	}
+
+	if c.PublishedAfter != nil && c.PublishedBefore != nil {
+		v.Check(!c.PublishedBefore.Before(*c.PublishedAfter), "published_before", "must not be before published_after")
+	}
+	if c.MinRating != nil {
+		v.Check(*c.MinRating >= 0 && *c.MinRating <= 5, "min_rating", "must be between 0 and 5")
+	}
+	if c.MaxRating != nil {
+		v.Check(*c.MaxRating >= 0 && *c.MaxRating <= 5, "max_rating", "must be between 0 and 5")
+	}
+	if c.MinRating != nil && c.MaxRating != nil {
+		v.Check(*c.MaxRating >= *c.MinRating, "max_rating", "must not be less than min_rating")
+	}
+	v.Check(c.AuthorID >= 0, "author_id", "must not be negative")
+	v.Check(c.InList >= 0, "in_list", "must not be negative")
+	v.Check(c.NotInList >= 0, "not_in_list", "must not be negative")
+}
+
+// bookCriteriaClause is the WHERE clause shared by every query that honours
+// a BookCriteria. It expects the books table to be aliased as b and the
+// arguments returned by BookCriteria.args() to be bound from $1. Deleted
+// books never match.
+const bookCriteriaClause = `
+	b.deleted_at IS NULL
+	AND (b.search_vector @@ websearch_to_tsquery('english', $1) OR $1 = ''
+		OR ($16 AND ($1 <% b.title OR EXISTS (
+			SELECT 1
+			FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = b.id AND $1 <% a.name
+		))))
+	AND (b.title ILIKE '%' || $2 || '%' OR $2 = '' OR ($16 AND $2 <% b.title))
+	AND (EXISTS (
+		SELECT 1
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = b.id AND (a.name ILIKE '%' || $3 || '%' OR ($16 AND $3 <% a.name))
+	) OR $3 = '')
+	AND ($4 = '' OR b.id IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM genres WHERE slug = $4
+			UNION
+			SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+		)
+		SELECT bg.book_id FROM book_genres bg JOIN subtree s ON s.id = bg.genre_id
+	))
+	AND (cardinality($5::text[]) = 0 OR b.id IN (
+		SELECT bt.book_id
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE t.name = ANY($5::text[])
+		GROUP BY bt.book_id
+		HAVING $6 <> 'all' OR COUNT(DISTINCT t.name) = cardinality($5::text[])
+	))
+	AND ($7::date IS NULL OR b.publication_date >= $7::date)
+	AND ($8::date IS NULL OR b.publication_date <= $8::date)
+	AND ($9::float8 IS NULL OR COALESCE(b.average_rating, 0) >= $9::float8)
+	AND ($10::float8 IS NULL OR COALESCE(b.average_rating, 0) <= $10::float8)
+	AND (b.isbn = $11 OR EXISTS (SELECT 1 FROM editions e WHERE e.book_id = b.id AND e.isbn = $11) OR $11 = '')
+	AND ($12::bigint = 0 OR EXISTS (
+		SELECT 1 FROM book_authors ba WHERE ba.book_id = b.id AND ba.author_id = $12::bigint
+	))
+	AND ($13::boolean IS NULL OR EXISTS (
+		SELECT 1 FROM reviews r WHERE r.book_id = b.id
+	) = $13::boolean)
+	AND ($14::bigint = 0 OR EXISTS (
+		SELECT 1 FROM reading_lists_books rlb WHERE rlb.book_id = b.id AND rlb.reading_list_id = $14::bigint
+	))
+	AND ($15::bigint = 0 OR NOT EXISTS (
+		SELECT 1 FROM reading_lists_books rlb WHERE rlb.book_id = b.id AND rlb.reading_list_id = $15::bigint
+	))`
+
+// args returns the values for the placeholders in bookCriteriaClause
+func (c BookCriteria) args() []any {
+	tags := tagSlugs(c.Tags)
+	return []any{c.Query, c.Title, c.Author, GenreSlug(c.Genre), pq.Array(tags), c.TagMatch,
+		c.PublishedAfter, c.PublishedBefore, c.MinRating, c.MaxRating, c.ISBN, c.AuthorID, c.HasReviews, c.InList, c.NotInList, c.Fuzzy}
 }
 
 func ValidateBook(v *validator.Validator, b *Book) {
@@ -37,18 +164,24 @@ func ValidateBook(v *validator.Validator, b *Book) {
 
 // Insert inserts a new book into the database
 func (m BookModel) Insert(book *Book) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertBook(ctx, m.DB, book)
+}
+
+// ISBNExists reports whether a book, or an edition of one, with the ISBN is
+// already in the catalogue
+func (m BookModel) ISBNExists(isbn string) (bool, error) {
 	query := `
-		INSERT INTO books (title, isbn, publication_date, genre, description, average_rating) 
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, version
+		SELECT EXISTS (SELECT 1 FROM books WHERE isbn = $1) OR EXISTS (SELECT 1 FROM editions WHERE isbn = $1)
 		`
-	args := []any{book.Title, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.AverageRating}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Insert and retrieve the new book ID and version
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.Version)
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, isbn).Scan(&exists)
+	return exists, err
 }
 
 // Get fetches a book by ID
@@ -58,11 +191,13 @@ func (m *BookModel) Get(bookID int64) (*Book, []Author, error) {
 	}
 
 	query := `
-		SELECT b.*,a.name
+		SELECT b.id, b.title, b.isbn, b.publication_date, b.genre, b.description, b.average_rating, b.version,
+			(SELECT COUNT(*) FROM reviews r WHERE r.book_id = b.id), b.cover_content_type, b.cover_updated_at, b.cover_version, b.series_id, COALESCE(s.name, ''), b.series_position, a.name
 		FROM books b
+		LEFT JOIN series s ON s.id = b.series_id
 		JOIN book_authors ba ON b.id = ba.book_id
 		JOIN authors a ON a.id = ba.author_id
-		WHERE b.id = $1
+		WHERE b.id = $1 AND b.deleted_at IS NULL
 		`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -77,7 +212,9 @@ func (m *BookModel) Get(bookID int64) (*Book, []Author, error) {
 	defer rows.Close()
 
 	// Loop through each row, appending authors to a map (avoiding duplicates)
+	found := false
 	for rows.Next() {
+		found = true
 		var author Author
 		err := rows.Scan(
 			&book.ID,
@@ -88,6 +225,13 @@ func (m *BookModel) Get(bookID int64) (*Book, []Author, error) {
 			&book.Description,
 			&book.AverageRating,
 			&book.Version,
+			&book.ReviewCount,
+			&book.CoverContentType,
+			&book.CoverUpdatedAt,
+			&book.CoverVersion,
+			&book.SeriesID,
+			&book.SeriesName,
+			&book.SeriesPosition,
 			&author.Name,
 		)
 		if err != nil {
@@ -100,6 +244,13 @@ func (m *BookModel) Get(bookID int64) (*Book, []Author, error) {
 		}
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, ErrRecordNotFound
+	}
+
 	// Convert map to slice
 	authors := make([]Author, 0, len(authorMap))
 	for _, author := range authorMap {
@@ -111,66 +262,138 @@ func (m *BookModel) Get(bookID int64) (*Book, []Author, error) {
 
 // Update updates a book in the database
 func (m BookModel) Update(book *Book) error {
-	query := `
-		UPDATE books
-		SET title = $1, isbn = $2, publication_date = $3, genre = $4, description = $5, average_rating = $6, version = version + 1
-		WHERE id = $7 
-		RETURNING version
-		`
-	args := []any{book.Title, book.ISBN, book.PublicationDate, book.Genre, book.Description, book.AverageRating, book.ID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	return updateBook(ctx, m.DB, book)
 }
 
-// Delete deletes a book from the database
-func (m BookModel) Delete(id int64) error {
+// SetCover records a newly uploaded cover of the given content type
+func (m BookModel) SetCover(book *Book, contentType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return setBookCover(ctx, m.DB, book, contentType)
+}
+
+// Delete moves a book to the trash, in a revision made by the user. It
+// keeps its authors, reviews and reading list entries until it is purged.
+func (m BookModel) Delete(id int64, userID int64) error {
 	//check if the id is valid
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `
-		DELETE FROM books
-		WHERE id = $1
-		`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// were any rows deleted?
-	rowsAffected, err := result.RowsAffected()
+	deleted, err := trashBook(ctx, tx, id, userID)
 	if err != nil {
 		return err
 	}
+	if !deleted {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// trashBook moves a book to the trash and records it as a revision made by
+// the user. It reports whether there was such a book outside the trash.
+func trashBook(ctx context.Context, q dbtx, id int64, userID int64) (bool, error) {
+	before, _, err := bookSnapshot(ctx, q, id)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	query := `
+		UPDATE books
+		SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		`
+	result, err := q.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
 
+	// were any rows deleted?
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return false, nil
 	}
 
-	return nil
+	_, err = recordBookRevision(ctx, q, id, &userID, RevisionDelete, before, nil)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// bookSortColumns maps the book sort keys to their SQL expressions
+var bookSortColumns = map[string]string{
+	"id":               "b.id",
+	"title":            "b.title",
+	"genre":            "b.genre",
+	"publication_date": "b.publication_date",
+	"average_rating":   "COALESCE(b.average_rating, 0)",
+	// books sort by the first of their authors in alphabetical order
+	"author":       "COALESCE((SELECT MIN(a.name) FROM book_authors ba JOIN authors a ON a.id = ba.author_id WHERE ba.book_id = b.id), '')",
+	"review_count": "(SELECT COUNT(*) FROM reviews r WHERE r.book_id = b.id)",
+}
 
+// bookColumns are the columns of the book listing, in the order they scan
+var bookColumns = []fieldColumn{
+	{"id", "b.id", "b.id"},
+	{"title", "b.title", "''"},
+	{"isbn", "b.isbn", "''"},
+	{"publication_date", "b.publication_date", "'0001-01-01'::date"},
+	{"genre", "b.genre", "''"},
+	{"description", "b.description", "''"},
+	{"average_rating", "b.average_rating", "0"},
+	{"review_count", bookSortColumns["review_count"], "0"},
+	{"version", "b.version", "0"},
 }
 
-// list all the books with pagination
-func (m *BookModel) GetAll(title, genre string, filters Filters) ([]*Book, Metadata, error) {
+// bookRelevance ranks a book against the full-text query in $1. How
+// closely the title matches counts too, so misspelled queries still rank
+// the book they were meant for first.
+const bookRelevance = "CASE WHEN $1 = '' THEN 0 ELSE ts_rank(b.search_vector, websearch_to_tsquery('english', $1)) + word_similarity($1, b.title) / 2 END"
+
+// list all the books matching the criteria with pagination
+func (m *BookModel) GetAll(criteria BookCriteria, filters Filters) ([]*Book, Metadata, error) {
+	keys, err := filters.sortKeys(bookSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	page := newKeyset(filters, keys, "b.id")
+
+	args := criteria.args()
+	seek, seekArgs := page.where(len(args) + 1)
+	args = append(args, seekArgs...)
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, title, isbn, publication_date, genre, description, average_rating, version
-		FROM books
-		WHERE (title ILIKE '%%' || $1 || '%%' OR $1 = '')
-		AND (genre ILIKE '%%' || $2 || '%%' OR $2 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		SELECT %s, %s%s
+		FROM books b
+		WHERE %s AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, page.countColumn(), selectFields(bookColumns, filters.Fields), page.keyColumns(), bookCriteriaClause, seek, page.orderBy(), len(args)+1, len(args)+2)
+	args = append(args, page.limit(), page.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, title, genre, filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -181,7 +404,8 @@ func (m *BookModel) GetAll(title, genre string, filters Filters) ([]*Book, Metad
 
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(&totalRecords, &book.ID, &book.Title, &book.ISBN, &book.PublicationDate, &book.Genre, &book.Description, &book.AverageRating, &book.Version)
+		dest := []any{&totalRecords, &book.ID, &book.Title, &book.ISBN, &book.PublicationDate, &book.Genre, &book.Description, &book.AverageRating, &book.ReviewCount, &book.Version}
+		err := rows.Scan(append(dest, page.dest(&book.ID)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -192,41 +416,118 @@ func (m *BookModel) GetAll(title, genre string, filters Filters) ([]*Book, Metad
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	books, metadata := keysetPage(page, books, totalRecords)
 	return books, metadata, nil
 }
 
-func (m *BookModel) Search(title, author, genre string, filters Filters) ([]*Book, Metadata, error) {
+// BookSearchResult is a book matched by Search along with how well it
+// matched the full-text query and highlighted snippets of the match. The
+// highlights are safe HTML: the text is escaped and the matches are
+// wrapped in <mark> tags.
+type BookSearchResult struct {
+	Book
+	Relevance          float64 `json:"relevance"`
+	TitleHighlight     string  `json:"title_highlight,omitempty"`
+	DescriptionSnippet string  `json:"description_snippet,omitempty"`
+}
+
+// escapeHTML returns an SQL expression escaping the characters of the text
+// in column that are special in HTML. The highlights are generated from the
+// escaped text so the only markup in them is the <mark> tags ts_headline
+// adds; the escapes are parsed as entities and do not change the matches.
+func escapeHTML(column string) string {
+	return fmt.Sprintf(`replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`, column)
+}
+
+// Search looks up books matching the criteria, ranking them against the
+// weighted full-text search vector. Sorting by "relevance" orders the
+// results by that rank.
+func (m *BookModel) Search(criteria BookCriteria, filters Filters) ([]*BookSearchResult, Metadata, error) {
+	columns := map[string]string{"relevance": bookRelevance}
+	for key, expression := range bookSortColumns {
+		columns[key] = expression
+	}
+	keys, err := filters.sortKeys(columns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	// the best matches always come first
+	for i := range keys {
+		if keys[i].expression == bookRelevance {
+			keys[i].descending = true
+		}
+	}
+	orderBy := orderByKeys(keys)
+
+	args := criteria.args()
+	// The inner query finds the requested page of matches. The highlights are
+	// only generated for that page since ts_headline is expensive. The
+	// position keeps the order of the page for the outer query.
+	// Only the fields asked for are highlighted and counted.
+	fields := []fieldColumn{
+		{"id", "id", "id"},
+		{"title", "title", "''"},
+		{"isbn", "isbn", "''"},
+		{"publication_date", "publication_date", "'0001-01-01'::date"},
+		{"genre", "genre", "''"},
+		{"description", "description", "''"},
+		{"average_rating", "average_rating", "0"},
+		{"review_count", "review_count", "0"},
+		{"version", "version", "0"},
+		{"relevance", "relevance", "0"},
+		{"title_highlight", fmt.Sprintf(`CASE WHEN $1 = '' THEN '' ELSE ts_headline('english', %s, websearch_to_tsquery('english', $1),
+			'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') END`, escapeHTML("title")), "''"},
+		{"description_snippet", fmt.Sprintf(`CASE WHEN $1 = '' THEN '' ELSE ts_headline('english', %s, websearch_to_tsquery('english', $1),
+			'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10') END`, escapeHTML("description")), "''"},
+	}
+	reviewCount := selectFields([]fieldColumn{{"review_count", bookSortColumns["review_count"], "0"}}, filters.Fields)
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), b.id, b.title, b.isbn, b.publication_date, b.genre, b.description, b.average_rating, b.version
-		FROM books b
-		JOIN book_authors ba ON b.id = ba.book_id
-		JOIN authors a ON a.id = ba.author_id
-		WHERE (b.title ILIKE '%%' || $1 || '%%' OR $1 = '')
-		AND (a.name ILIKE '%%' || $2 || '%%' OR $2 = '')
-		AND (b.genre ILIKE '%%' || $3 || '%%' OR $3 = '')
-		ORDER BY %s %s, b.id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+		SELECT total, %s
+		FROM (
+			SELECT COUNT(*) OVER() AS total, b.id, b.title, b.isbn, b.publication_date, b.genre, b.description, b.average_rating,
+				%s AS review_count, b.version,
+				%s AS relevance, ROW_NUMBER() OVER (ORDER BY %s, b.id ASC) AS position
+			FROM books b
+			WHERE %s
+			ORDER BY position
+			LIMIT $%d OFFSET $%d
+		) page
+		ORDER BY position`, selectFields(fields, filters.Fields), reviewCount, bookRelevance, orderBy, bookCriteriaClause, len(args)+1, len(args)+2)
+	args = append(args, filters.limit(), filters.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, title, author, genre, filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
-	var books []*Book
+	var books []*BookSearchResult
 	totalRecords := 0
 
 	for rows.Next() {
-		var book Book
-		err := rows.Scan(&totalRecords, &book.ID, &book.Title, &book.ISBN, &book.PublicationDate, &book.Genre, &book.Description, &book.AverageRating, &book.Version)
+		var result BookSearchResult
+		err := rows.Scan(
+			&totalRecords,
+			&result.ID,
+			&result.Title,
+			&result.ISBN,
+			&result.PublicationDate,
+			&result.Genre,
+			&result.Description,
+			&result.AverageRating,
+			&result.ReviewCount,
+			&result.Version,
+			&result.Relevance,
+			&result.TitleHighlight,
+			&result.DescriptionSnippet,
+		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		books = append(books, &book)
+		books = append(books, &result)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -237,20 +538,44 @@ func (m *BookModel) Search(title, author, genre string, filters Filters) ([]*Boo
 	return books, metadata, nil
 }
 
-// update the book average rating
-func (m *BookModel) UpdateAverageRating(id int64) error {
+// RepairRatings recomputes the rating count, sum and average of every book
+// from its reviews, which the reviews trigger otherwise keeps up to date. It
+// returns how many books were out of step.
+func (m *BookModel) RepairRatings() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// reviews written while the totals are computed would be lost
+	_, err = tx.ExecContext(ctx, `LOCK TABLE reviews IN SHARE MODE`)
+	if err != nil {
+		return 0, err
+	}
+
 	query := `
-		UPDATE books
-		SET average_rating = (
-			SELECT COALESCE(AVG(rating), 0)
-			FROM reviews
-			WHERE book_id = $1
+		WITH actual AS (
+			SELECT b.id, COUNT(r.rating) AS count, COALESCE(SUM(r.rating), 0) AS sum
+			FROM books b
+			LEFT JOIN reviews r ON r.book_id = b.id
+			GROUP BY b.id
 		)
-		WHERE id = $1
-		`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+		UPDATE books b
+		SET rating_count = a.count, rating_sum = a.sum,
+			average_rating = CASE WHEN a.count > 0 THEN a.sum::real / a.count ELSE 0 END
+		FROM actual a
+		WHERE a.id = b.id
+		AND (b.rating_count <> a.count OR b.rating_sum <> a.sum
+			OR b.average_rating IS DISTINCT FROM CASE WHEN a.count > 0 THEN a.sum::real / a.count ELSE 0 END)
+	`
+	repaired, err := execCount(ctx, tx, query)
+	if err != nil {
+		return 0, err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, id)
-	return err
+	return repaired, tx.Commit()
 }
@@ -0,0 +1,300 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks a position in a sorted listing: the sort it was issued for,
+// the sort key values of a row and the row's id, which breaks ties
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     int64    `json:"id"`
+}
+
+// encode turns the cursor into the opaque string handed to clients
+func (c cursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var c cursor
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return nil, errInvalidCursor
+	}
+	return &c, nil
+}
+
+// cursorProblem explains why a cursor cannot be used with the filters,
+// returning an empty string when it can
+func cursorProblem(f Filters, value string) string {
+	c, err := decodeCursor(value)
+	if err != nil {
+		return "is not a valid cursor"
+	}
+	keys := strings.Split(f.Sort, ",")
+	if c.Sort != f.Sort || len(c.Values) != len(keys) {
+		return "was issued for a different sort"
+	}
+	// the values end up in the query, where one that does not cast to the
+	// type of its key would fail the whole listing
+	for i, key := range keys {
+		if !validSortValue(strings.TrimPrefix(key, "-"), c.Values[i]) {
+			return "is not a valid cursor"
+		}
+	}
+	return ""
+}
+
+// sortKeyTypes are the types of the sort keys that are not text. A sort
+// key has the same type in every listing that pages with cursors.
+var sortKeyTypes = map[string]string{
+	"id":               "bigint",
+	"created_by":       "integer",
+	"rating":           "integer",
+	"review_count":     "bigint",
+	"book_count":       "bigint",
+	"average_rating":   "real",
+	"publication_date": "date",
+	"review_date":      "timestamp",
+}
+
+// realRX matches a real as Postgres writes it as text
+var realRX = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?(e[-+][0-9]+)?$`)
+
+// validSortValue reports whether a sort key value, as selected by
+// keyColumns, is of the type of the key
+func validSortValue(key, value string) bool {
+	switch sortKeyTypes[key] {
+	case "integer":
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case "bigint":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case "real":
+		return realRX.MatchString(value)
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "timestamp":
+		// the offset has minutes only for time zones that need them
+		for _, layout := range []string{"2006-01-02 15:04:05.999999-07", "2006-01-02 15:04:05.999999-07:00"} {
+			if _, err := time.Parse(layout, value); err == nil {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// sortKey is one SQL expression a listing is ordered by
+type sortKey struct {
+	expression string
+	descending bool
+}
+
+// keysetRow holds the sort key values of a fetched row, used to build the
+// cursors of the page
+type keysetRow struct {
+	id     *int64
+	values []string
+}
+
+// keyset pages through a listing either by page number or, when the
+// filters carry an after or before cursor, by seeking past the cursor on
+// the sort keys and id. Seeking avoids both the OFFSET and the total count,
+// which get slow on large tables.
+type keyset struct {
+	filters  Filters
+	keys     []sortKey
+	idColumn string
+	cursor   *cursor
+	// before pages are fetched in reverse and flipped afterwards
+	backwards bool
+	rows      []*keysetRow
+}
+
+// newKeyset sets up the paging of a listing ordered by keys, with ties
+// broken by idColumn. The sort key expressions must not be NULL.
+func newKeyset(filters Filters, keys []sortKey, idColumn string) *keyset {
+	k := &keyset{filters: filters, keys: keys, idColumn: idColumn}
+
+	// the filters have been validated, so a cursor decodes fine
+	switch {
+	case filters.After != "":
+		k.cursor, _ = decodeCursor(filters.After)
+	case filters.Before != "":
+		k.cursor, _ = decodeCursor(filters.Before)
+		k.backwards = true
+	}
+	return k
+}
+
+// countColumn is the select expression for the total number of records,
+// which is only worked out for numbered pages
+func (k *keyset) countColumn() string {
+	if k.cursor != nil {
+		return "0"
+	}
+	return "COUNT(*) OVER()"
+}
+
+// keyColumns selects the sort key values as text for the cursors
+func (k *keyset) keyColumns() string {
+	var columns strings.Builder
+	for _, key := range k.keys {
+		fmt.Fprintf(&columns, ", (%s)::text", key.expression)
+	}
+	return columns.String()
+}
+
+// where returns the condition selecting the rows past the cursor and its
+// arguments, numbered from next. Without a cursor every row matches.
+func (k *keyset) where(next int) (string, []any) {
+	if k.cursor == nil || len(k.cursor.Values) != len(k.keys) {
+		return "TRUE", nil
+	}
+
+	// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ... OR (k1 = v1 AND ... AND id > n),
+	// with the comparison flipped for descending keys and before cursors
+	var args []any
+	var equal []string
+	var alternatives []string
+	for i, key := range k.keys {
+		placeholder := fmt.Sprintf("$%d", next+i)
+		args = append(args, k.cursor.Values[i])
+
+		operator := ">"
+		if key.descending != k.backwards {
+			operator = "<"
+		}
+		condition := append(slices.Clone(equal), fmt.Sprintf("%s %s %s", key.expression, operator, placeholder))
+		alternatives = append(alternatives, "("+strings.Join(condition, " AND ")+")")
+		equal = append(equal, fmt.Sprintf("%s = %s", key.expression, placeholder))
+	}
+
+	operator := ">"
+	if k.backwards {
+		operator = "<"
+	}
+	condition := append(equal, fmt.Sprintf("%s %s $%d", k.idColumn, operator, next+len(k.keys)))
+	alternatives = append(alternatives, "("+strings.Join(condition, " AND ")+")")
+	args = append(args, k.cursor.ID)
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// orderBy returns the ORDER BY list, reversed when paging backwards
+func (k *keyset) orderBy() string {
+	direction := func(descending bool) string {
+		if descending != k.backwards {
+			return "DESC"
+		}
+		return "ASC"
+	}
+
+	var terms []string
+	for _, key := range k.keys {
+		terms = append(terms, key.expression+" "+direction(key.descending))
+	}
+	terms = append(terms, k.idColumn+" "+direction(false))
+	return strings.Join(terms, ", ")
+}
+
+// limit fetches one extra row when seeking, to tell whether there are more
+func (k *keyset) limit() int {
+	if k.cursor != nil {
+		return k.filters.limit() + 1
+	}
+	return k.filters.limit()
+}
+
+func (k *keyset) offset() int {
+	if k.cursor != nil {
+		return 0
+	}
+	return k.filters.offset()
+}
+
+// dest returns the scan destinations for the sort key columns of the row
+// whose id is scanned into id
+func (k *keyset) dest(id *int64) []any {
+	row := &keysetRow{id: id, values: make([]string, len(k.keys))}
+	k.rows = append(k.rows, row)
+
+	dest := make([]any, len(row.values))
+	for i := range row.values {
+		dest[i] = &row.values[i]
+	}
+	return dest
+}
+
+func (k *keyset) cursorFor(row *keysetRow) string {
+	return cursor{Sort: k.filters.Sort, Values: row.values, ID: *row.id}.encode()
+}
+
+// keysetPage trims and orders the fetched items and works out the metadata
+// with the cursors of the neighbouring pages
+func keysetPage[T any](k *keyset, items []T, totalRecords int) ([]T, Metadata) {
+	if k.cursor == nil {
+		metadata := calculateMetaData(totalRecords, k.filters.Page, k.filters.PageSize)
+		if len(items) > 0 {
+			if metadata.CurrentPage < metadata.LastPage {
+				metadata.NextCursor = k.cursorFor(k.rows[len(k.rows)-1])
+			}
+			if metadata.CurrentPage > 1 {
+				metadata.PrevCursor = k.cursorFor(k.rows[0])
+			}
+		}
+		return items, metadata
+	}
+
+	more := len(items) > k.filters.PageSize
+	if more {
+		items = items[:k.filters.PageSize]
+		k.rows = k.rows[:k.filters.PageSize]
+	}
+	if k.backwards {
+		slices.Reverse(items)
+		slices.Reverse(k.rows)
+	}
+
+	metadata := Metadata{PageSize: k.filters.PageSize}
+	if len(items) == 0 {
+		return items, metadata
+	}
+
+	// coming from a cursor there is always a page on the side it came from
+	first, last := k.cursorFor(k.rows[0]), k.cursorFor(k.rows[len(k.rows)-1])
+	if k.backwards {
+		metadata.NextCursor = last
+		if more {
+			metadata.PrevCursor = first
+		}
+	} else {
+		metadata.PrevCursor = first
+		if more {
+			metadata.NextCursor = last
+		}
+	}
+	return items, metadata
+}
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	c := cursor{Sort: "-average_rating,title", Values: []string{"4.5", "Dune"}, ID: 42}
+
+	got, err := decodeCursor(c.encode())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*got, c) {
+		t.Errorf("got %+v, want %+v", *got, c)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "not a cursor!"},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("title"))},
+		{"no id", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":["Dune"]}`))},
+		{"negative id", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":["Dune"],"id":-1}`))},
+		{"values not strings", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"title","v":[1],"id":1}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.value)
+			if err != errInvalidCursor {
+				t.Errorf("got error %v, want %v", err, errInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestCursorProblem(t *testing.T) {
+	tests := []struct {
+		name    string
+		sort    string
+		cursor  cursor
+		problem string
+	}{
+		{
+			name:   "text key",
+			sort:   "title",
+			cursor: cursor{Sort: "title", Values: []string{"Dune"}, ID: 1},
+		},
+		{
+			name:   "typed keys",
+			sort:   "-average_rating,publication_date,review_count",
+			cursor: cursor{Sort: "-average_rating,publication_date,review_count", Values: []string{"4.5", "1965-08-01", "12"}, ID: 1},
+		},
+		{
+			name:   "timestamp",
+			sort:   "review_date",
+			cursor: cursor{Sort: "review_date", Values: []string{"2024-03-01 10:15:00.123+00"}, ID: 1},
+		},
+		{
+			name:   "timestamp with a minute offset",
+			sort:   "review_date",
+			cursor: cursor{Sort: "review_date", Values: []string{"2024-03-01 10:15:00+05:30"}, ID: 1},
+		},
+		{
+			name:    "different sort",
+			sort:    "title",
+			cursor:  cursor{Sort: "-title", Values: []string{"Dune"}, ID: 1},
+			problem: "was issued for a different sort",
+		},
+		{
+			name:    "missing value",
+			sort:    "title,id",
+			cursor:  cursor{Sort: "title,id", Values: []string{"Dune"}, ID: 1},
+			problem: "was issued for a different sort",
+		},
+		{
+			name:    "not an integer",
+			sort:    "review_count",
+			cursor:  cursor{Sort: "review_count", Values: []string{"many"}, ID: 1},
+			problem: "is not a valid cursor",
+		},
+		{
+			name:    "integer out of range",
+			sort:    "rating",
+			cursor:  cursor{Sort: "rating", Values: []string{"3000000000"}, ID: 1},
+			problem: "is not a valid cursor",
+		},
+		{
+			name:    "not a real",
+			sort:    "-average_rating",
+			cursor:  cursor{Sort: "-average_rating", Values: []string{"NaN"}, ID: 1},
+			problem: "is not a valid cursor",
+		},
+		{
+			name:    "not a date",
+			sort:    "publication_date",
+			cursor:  cursor{Sort: "publication_date", Values: []string{"1965-13-01"}, ID: 1},
+			problem: "is not a valid cursor",
+		},
+		{
+			name:    "not a timestamp",
+			sort:    "review_date",
+			cursor:  cursor{Sort: "review_date", Values: []string{"yesterday"}, ID: 1},
+			problem: "is not a valid cursor",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := cursorProblem(Filters{Sort: tt.sort}, tt.cursor.encode())
+			if problem != tt.problem {
+				t.Errorf("got %q, want %q", problem, tt.problem)
+			}
+		})
+	}
+}
+
+func TestKeysetWhere(t *testing.T) {
+	keys := []sortKey{
+		{expression: "b.average_rating", descending: true},
+		{expression: "b.title"},
+	}
+	c := cursor{Sort: "-average_rating,title", Values: []string{"4.5", "Dune"}, ID: 7}
+
+	tests := []struct {
+		name    string
+		filters Filters
+		where   string
+		args    []any
+	}{
+		{
+			name:    "no cursor",
+			filters: Filters{Sort: c.Sort, Page: 1, PageSize: 10},
+			where:   "TRUE",
+		},
+		{
+			name:    "after",
+			filters: Filters{Sort: c.Sort, Page: 1, PageSize: 10, After: c.encode()},
+			where:   "((b.average_rating < $3) OR (b.average_rating = $3 AND b.title > $4) OR (b.average_rating = $3 AND b.title = $4 AND b.id > $5))",
+			args:    []any{"4.5", "Dune", int64(7)},
+		},
+		{
+			name:    "before",
+			filters: Filters{Sort: c.Sort, Page: 1, PageSize: 10, Before: c.encode()},
+			where:   "((b.average_rating > $3) OR (b.average_rating = $3 AND b.title < $4) OR (b.average_rating = $3 AND b.title = $4 AND b.id < $5))",
+			args:    []any{"4.5", "Dune", int64(7)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := newKeyset(tt.filters, keys, "b.id").where(3)
+			if where != tt.where {
+				t.Errorf("got where %q, want %q", where, tt.where)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got args %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestKeysetOrderBy(t *testing.T) {
+	keys := []sortKey{
+		{expression: "b.average_rating", descending: true},
+		{expression: "b.title"},
+	}
+	c := cursor{Sort: "-average_rating,title", Values: []string{"4.5", "Dune"}, ID: 7}
+
+	forwards := newKeyset(Filters{Sort: c.Sort, PageSize: 10, After: c.encode()}, keys, "b.id")
+	if got, want := forwards.orderBy(), "b.average_rating DESC, b.title ASC, b.id ASC"; got != want {
+		t.Errorf("after: got %q, want %q", got, want)
+	}
+	backwards := newKeyset(Filters{Sort: c.Sort, PageSize: 10, Before: c.encode()}, keys, "b.id")
+	if got, want := backwards.orderBy(), "b.average_rating ASC, b.title DESC, b.id DESC"; got != want {
+		t.Errorf("before: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,344 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+var ErrPrimaryEdition = errors.New("primary edition")
+
+// EditionFormats are the formats a work is published in
+var EditionFormats = []string{"hardcover", "paperback", "ebook", "audiobook"}
+
+// ISO 639 language codes, like "en" or "haw"
+var languageRX = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// Edition is one published form of a work (a book in the books API). The
+// primary edition carries the ISBN and publication date of the work.
+type Edition struct {
+	ID              int64      `json:"id"`
+	WorkID          int64      `json:"work_id"`
+	Title           string     `json:"title"`  // of the work
+	ISBN            string     `json:"isbn"`   // empty when unknown
+	Format          string     `json:"format"` // empty for editions carried over from the books
+	PageCount       *int       `json:"page_count"`
+	DurationMinutes *int       `json:"duration_minutes"` // audiobooks only
+	Publisher       string     `json:"publisher"`
+	Language        string     `json:"language"`
+	PublicationDate *time.Time `json:"publication_date"`
+	Primary         bool       `json:"primary"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Version         int32      `json:"version"`
+}
+
+// EditionCriteria narrows an edition listing down. Empty fields are ignored.
+type EditionCriteria struct {
+	WorkID   int64
+	ISBN     string
+	Format   string
+	Language string
+}
+
+type EditionModel struct {
+	DB *sql.DB
+}
+
+// ValidateEdition validates the edition fields
+func ValidateEdition(v *validator.Validator, e *Edition) {
+	v.Check(e.WorkID > 0, "work_id", "must be provided")
+	v.Check(len(e.ISBN) <= 20, "isbn", "must not be more than 20 bytes long")
+	v.Check(e.Format == "" || validator.PermittedValue(e.Format, EditionFormats...), "format", "must be one of hardcover, paperback, ebook or audiobook")
+	if e.PageCount != nil {
+		v.Check(*e.PageCount > 0 && *e.PageCount <= 100000, "page_count", "must be between 1 and 100000")
+		v.Check(e.Format != "audiobook", "page_count", "must not be given for an audiobook")
+	}
+	if e.DurationMinutes != nil {
+		v.Check(*e.DurationMinutes > 0 && *e.DurationMinutes <= 100000, "duration_minutes", "must be between 1 and 100000")
+		v.Check(e.Format == "audiobook", "duration_minutes", "must only be given for an audiobook")
+	}
+	v.Check(len(e.Publisher) <= 200, "publisher", "must not be more than 200 bytes long")
+	v.Check(e.Language == "" || languageRX.MatchString(e.Language), "language", "must be a lowercase ISO 639 language code")
+
+	// the books API shows the primary edition, which needs both
+	if e.Primary {
+		v.Check(e.ISBN != "", "isbn", "must be provided for the primary edition")
+		v.Check(e.PublicationDate != nil, "publication_date", "must be provided for the primary edition")
+	}
+}
+
+// editionColumns are selected, in order, by every query scanned into editionDest
+const editionColumns = `e.id, e.book_id, b.title, COALESCE(e.isbn, ''), COALESCE(e.format, ''), e.page_count,
+	e.duration_minutes, e.publisher, e.language, e.publication_date, e.is_primary, e.created_at, e.version`
+
+func editionDest(e *Edition) []any {
+	return []any{&e.ID, &e.WorkID, &e.Title, &e.ISBN, &e.Format, &e.PageCount,
+		&e.DurationMinutes, &e.Publisher, &e.Language, &e.PublicationDate, &e.Primary, &e.CreatedAt, &e.Version}
+}
+
+// editionError maps a unique violation of the ISBN to ErrDuplicateISBN
+func editionError(err error) error {
+	if err.Error() == `pq: duplicate key value violates unique constraint "editions_isbn_key"` {
+		return ErrDuplicateISBN
+	}
+	return err
+}
+
+// Insert adds a new edition to a work that is not in the trash. It fails
+// with ErrRecordNotFound when there is no such work.
+func (m *EditionModel) Insert(e *Edition) error {
+	query := `
+		INSERT INTO editions (book_id, isbn, format, page_count, duration_minutes, publisher, language, publication_date)
+		SELECT b.id, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, $8
+		FROM books b
+		WHERE b.id = $1 AND b.deleted_at IS NULL
+		RETURNING id, created_at, version
+	`
+	args := []any{e.WorkID, e.ISBN, e.Format, e.PageCount, e.DurationMinutes, e.Publisher, e.Language, e.PublicationDate}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&e.ID, &e.CreatedAt, &e.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return editionError(err)
+		}
+	}
+	return nil
+}
+
+// Get fetches an edition of a work that is not in the trash
+func (m *EditionModel) Get(id int64) (*Edition, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM editions e
+		JOIN books b ON b.id = e.book_id AND b.deleted_at IS NULL
+		WHERE e.id = $1`, editionColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var e Edition
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(editionDest(&e)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// Update updates an edition, failing with ErrEditConflict if it was changed
+// since it was read. Making an edition primary demotes the previous one,
+// and the work takes on the ISBN and publication date of its primary
+// edition, in a revision made by the user.
+func (m *EditionModel) Update(e *Edition, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the primary edition changes the work, which is recorded as a revision
+	var before *BookSnapshot
+	if e.Primary {
+		before, _, err = bookSnapshot(ctx, tx, e.WorkID)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE editions
+			SET is_primary = false, version = version + 1
+			WHERE book_id = $1 AND is_primary AND id <> $2
+		`
+		_, err = tx.ExecContext(ctx, query, e.WorkID, e.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE editions
+		SET isbn = NULLIF($1, ''), format = NULLIF($2, ''), page_count = $3, duration_minutes = $4,
+			publisher = $5, language = $6, publication_date = $7, is_primary = $8, version = version + 1
+		WHERE id = $9 AND version = $10
+		RETURNING version
+	`
+	args := []any{e.ISBN, e.Format, e.PageCount, e.DurationMinutes, e.Publisher, e.Language, e.PublicationDate, e.Primary, e.ID, e.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&e.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return editionError(err)
+		}
+	}
+
+	if e.Primary {
+		query := `
+			UPDATE books
+			SET isbn = $1, publication_date = $2, version = version + 1
+			WHERE id = $3 AND (isbn IS DISTINCT FROM $1 OR publication_date IS DISTINCT FROM $2)
+		`
+		_, err = tx.ExecContext(ctx, query, e.ISBN, e.PublicationDate, e.WorkID)
+		if err != nil {
+			return err
+		}
+
+		_, err = recordBookRevision(ctx, tx, e.WorkID, &userID, RevisionUpdate, before, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes an edition. The primary edition of a work can not be
+// deleted, ErrPrimaryEdition is returned for it.
+func (m *EditionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM editions
+		WHERE id = $1
+		RETURNING is_primary
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var primary bool
+	err = tx.QueryRowContext(ctx, query, id).Scan(&primary)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	if primary {
+		return ErrPrimaryEdition
+	}
+
+	return tx.Commit()
+}
+
+// editionSortColumns maps the edition sort keys to their SQL expressions
+var editionSortColumns = map[string]string{
+	"id":               "e.id",
+	"format":           "COALESCE(e.format, '')",
+	"language":         "e.language",
+	"publication_date": "e.publication_date",
+	"page_count":       "e.page_count",
+}
+
+// GetAll lists the editions of the works that are not in the trash
+func (m *EditionModel) GetAll(criteria EditionCriteria, filters Filters) ([]*Edition, Metadata, error) {
+	orderBy, err := filters.orderBy(editionSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM editions e
+		JOIN books b ON b.id = e.book_id AND b.deleted_at IS NULL
+		WHERE (e.book_id = $1 OR $1 = 0)
+		AND (e.isbn = $2 OR $2 = '')
+		AND (e.format = $3 OR $3 = '')
+		AND (e.language = $4 OR $4 = '')
+		ORDER BY %s, e.id ASC
+		LIMIT $5 OFFSET $6`, editionColumns, orderBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{criteria.WorkID, criteria.ISBN, criteria.Format, criteria.Language, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	editions := []*Edition{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var e Edition
+		err := rows.Scan(append([]any{&totalRecords}, editionDest(&e)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		editions = append(editions, &e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return editions, metadata, nil
+}
+
+// ForWork returns the editions of a work, the primary one first
+func (m *EditionModel) ForWork(workID int64) ([]*Edition, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM editions e
+		JOIN books b ON b.id = e.book_id
+		WHERE e.book_id = $1
+		ORDER BY e.is_primary DESC, e.publication_date ASC NULLS LAST, e.id ASC`, editionColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	editions := []*Edition{}
+	for rows.Next() {
+		var e Edition
+		err := rows.Scan(editionDest(&e)...)
+		if err != nil {
+			return nil, err
+		}
+		editions = append(editions, &e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return editions, nil
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// IncompleteBook is a book that lacks a description, authors or a cover
+type IncompleteBook struct {
+	Book
+	HasAuthors bool
+}
+
+// GetIncomplete returns up to limit books missing some of their metadata
+// that were not checked within the recheck period, the books never checked
+// coming first
+func (m BookModel) GetIncomplete(recheck time.Duration, limit int) ([]*IncompleteBook, error) {
+	query := `
+		SELECT b.id, b.title, b.isbn, b.description, b.cover_content_type, b.cover_updated_at, b.version,
+			EXISTS (SELECT 1 FROM book_authors ba WHERE ba.book_id = b.id)
+		FROM books b
+		WHERE b.deleted_at IS NULL
+		AND (b.description = ''
+			OR b.cover_updated_at IS NULL
+			OR NOT EXISTS (SELECT 1 FROM book_authors ba WHERE ba.book_id = b.id))
+		AND (b.metadata_checked_at IS NULL OR b.metadata_checked_at < NOW() - make_interval(secs => $1))
+		ORDER BY b.metadata_checked_at NULLS FIRST, b.id
+		LIMIT $2
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, recheck.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*IncompleteBook{}
+	for rows.Next() {
+		var book IncompleteBook
+		err := rows.Scan(
+			&book.ID,
+			&book.Title,
+			&book.ISBN,
+			&book.Description,
+			&book.CoverContentType,
+			&book.CoverUpdatedAt,
+			&book.Version,
+			&book.HasAuthors,
+		)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	return books, rows.Err()
+}
+
+// FillDescription sets the description of a book that still has none. It
+// reports whether the book was changed.
+func (t *BookTx) FillDescription(id int64, description string) (bool, error) {
+	query := `
+		UPDATE books
+		SET description = $1, version = version + 1
+		WHERE id = $2 AND description = ''
+		`
+	result, err := t.tx.ExecContext(t.ctx, query, description, id)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// MarkMetadataChecked records that the metadata of a book was looked up
+func (m BookModel) MarkMetadataChecked(id int64) error {
+	query := `
+		UPDATE books
+		SET metadata_checked_at = NOW()
+		WHERE id = $1
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
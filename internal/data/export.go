@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	exportBatchSize = 500
+	exportTimeout   = 10 * time.Minute
+)
+
+// ExportedBook is a book with its related data flattened for an export
+type ExportedBook struct {
+	Book
+	Authors []string
+	Genres  []string
+}
+
+// Export walks through every book matching the criteria in ID order and
+// calls fn for each of them. The books are read through a server-side
+// cursor in batches so the catalogue is never held in memory. An error
+// from fn stops the export and is returned.
+func (m *BookModel) Export(criteria BookCriteria, fn func(*ExportedBook) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	// cursors only live as long as the transaction they were declared in
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		DECLARE books_export NO SCROLL CURSOR FOR
+		SELECT b.id, b.title, b.isbn, b.publication_date, b.genre, b.description, b.average_rating, b.version,
+			ARRAY(
+				SELECT a.name
+				FROM book_authors ba
+				JOIN authors a ON a.id = ba.author_id
+				WHERE ba.book_id = b.id
+				ORDER BY a.name
+			),
+			ARRAY(
+				SELECT g.name
+				FROM book_genres bg
+				JOIN genres g ON g.id = bg.genre_id
+				WHERE bg.book_id = b.id
+				ORDER BY g.name = b.genre DESC, g.name
+			)
+		FROM books b
+		WHERE %s
+		ORDER BY b.id`, bookCriteriaClause)
+
+	_, err = tx.ExecContext(ctx, query, criteria.args()...)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM books_export", exportBatchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			var book ExportedBook
+			err := rows.Scan(
+				&book.ID,
+				&book.Title,
+				&book.ISBN,
+				&book.PublicationDate,
+				&book.Genre,
+				&book.Description,
+				&book.AverageRating,
+				&book.Version,
+				pq.Array(&book.Authors),
+				pq.Array(&book.Genres),
+			)
+			if err == nil {
+				err = fn(&book)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		// a short batch means the cursor is exhausted
+		if fetched < exportBatchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maximum number of authors returned in the author facet
+const authorFacetLimit = 25
+
+// FacetCount is the number of matching books that share a facet value
+type FacetCount struct {
+	ID    int64  `json:"id,omitempty"` // set for facets backed by a table (genres, authors)
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// BookFacets groups the facet counts of a book listing or search so a
+// client can render filter sidebars for the current result set.
+type BookFacets struct {
+	Genres  []FacetCount `json:"genres"`
+	Decades []FacetCount `json:"decades"`
+	Ratings []FacetCount `json:"ratings"`
+	Authors []FacetCount `json:"authors"`
+}
+
+// Facets counts the books matching the criteria per genre, publication
+// decade, average rating bucket and author. Pagination does not apply:
+// the counts cover every matching book.
+func (m *BookModel) Facets(criteria BookCriteria) (*BookFacets, error) {
+	// Each branch returns the facet name, the value, an optional id, the
+	// count and a key used to order the values within the facet.
+	query := fmt.Sprintf(`
+		WITH matched AS (
+			SELECT b.id, b.publication_date, b.average_rating
+			FROM books b
+			WHERE %s
+		)
+		SELECT 'genre', g.name, g.id, COUNT(*), -COUNT(*)
+		FROM matched m
+		JOIN book_genres bg ON bg.book_id = m.id
+		JOIN genres g ON g.id = bg.genre_id
+		GROUP BY g.id, g.name
+		UNION ALL
+		SELECT 'decade', decade || 's', 0, COUNT(*), decade
+		FROM (
+			SELECT (EXTRACT(YEAR FROM publication_date)::int / 10) * 10 AS decade
+			FROM matched
+			WHERE publication_date IS NOT NULL
+		) d
+		GROUP BY decade
+		UNION ALL
+		SELECT 'rating',
+			CASE WHEN bucket < 0 THEN 'unrated' ELSE bucket || '-' || bucket + 1 END,
+			0, COUNT(*), bucket
+		FROM (
+			SELECT CASE WHEN average_rating IS NULL OR average_rating = 0 THEN -1
+				ELSE LEAST(FLOOR(average_rating)::int, 4) END AS bucket
+			FROM matched
+		) r
+		GROUP BY bucket
+		UNION ALL
+		(
+			SELECT 'author', a.name, a.id, COUNT(*), -COUNT(*)
+			FROM matched m
+			JOIN book_authors ba ON ba.book_id = m.id
+			JOIN authors a ON a.id = ba.author_id
+			GROUP BY a.id, a.name
+			ORDER BY COUNT(*) DESC, a.name
+			LIMIT %d
+		)
+		ORDER BY 1, 5, 2`, bookCriteriaClause, authorFacetLimit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, criteria.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &BookFacets{
+		Genres:  []FacetCount{},
+		Decades: []FacetCount{},
+		Ratings: []FacetCount{},
+		Authors: []FacetCount{},
+	}
+
+	for rows.Next() {
+		var facet string
+		var count FacetCount
+		var sortKey int
+		err := rows.Scan(&facet, &count.Value, &count.ID, &count.Count, &sortKey)
+		if err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "genre":
+			facets.Genres = append(facets.Genres, count)
+		case "decade":
+			facets.Decades = append(facets.Decades, count)
+		case "rating":
+			facets.Ratings = append(facets.Ratings, count)
+		case "author":
+			facets.Authors = append(facets.Authors, count)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"strings"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// The fields a client can restrict each resource to with a sparse fieldset
+var (
+	BookFields        = []string{"id", "title", "isbn", "publication_date", "genre", "description", "average_rating", "review_count", "version", "included"}
+	BookSearchFields  = append([]string{"relevance", "title_highlight", "description_snippet"}, BookFields...)
+	ReviewFields      = []string{"id", "book_id", "user_id", "rating", "review", "review_date", "version"}
+	ReadingListFields = []string{"id", "name", "description", "created_by", "status", "version"}
+	UserFields        = []string{"id", "created_at", "username", "email", "activated"}
+)
+
+// ValidateFields checks that a sparse fieldset only names permitted fields
+func ValidateFields(v *validator.Validator, fields []string, safeList []string) {
+	for _, field := range fields {
+		if !validator.PermittedValue(field, safeList...) {
+			v.AddError("fields", "must be a comma-separated list of "+strings.Join(safeList, ", "))
+			return
+		}
+	}
+}
+
+// fieldColumn is the SQL expression selected for a JSON field and the one
+// selected instead when a sparse fieldset leaves the field out, so the rows
+// scan the same whatever fields were asked for
+type fieldColumn struct {
+	field      string
+	expression string
+	zero       string
+}
+
+// selectFields lists the expressions of the columns, only reading the ones
+// of the fields in the fieldset. An empty fieldset selects every field.
+func selectFields(columns []fieldColumn, fields []string) string {
+	expressions := make([]string, len(columns))
+	for i, column := range columns {
+		expressions[i] = column.expression
+		if len(fields) > 0 && !validator.PermittedValue(column.field, fields...) {
+			expressions[i] = column.zero
+		}
+	}
+	return strings.Join(expressions, ", ")
+}
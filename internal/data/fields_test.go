@@ -0,0 +1,20 @@
+package data
+
+import "testing"
+
+func TestSelectFields(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   string
+	}{
+		{nil, "id, name, description, created_by, status, version"},
+		{[]string{"name"}, "id, name, '', 0, '', 0"},
+		{[]string{"status", "id"}, "id, '', '', 0, status, 0"},
+	}
+
+	for _, tt := range tests {
+		if got := selectFields(readingListColumns, tt.fields); got != tt.want {
+			t.Errorf("selectFields(%q) = %q, want %q", tt.fields, got, tt.want)
+		}
+	}
+}
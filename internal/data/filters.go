@@ -1,11 +1,15 @@
 package data
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/validator"
 )
 
+// maxSortKeys limits how many keys a listing can be sorted by
+const maxSortKeys = 4
+
 // The Filters type will contain the fields related to pagination
 // and eventually the fields related to sorting.
 type Filters struct {
@@ -13,6 +17,13 @@ type Filters struct {
 	PageSize     int // how records per page
 	Sort         string
 	SortSafeList []string // allowed sort fields
+	// opaque cursors from Metadata, used instead of the page number to
+	// fetch the rows after or before a given row
+	After  string
+	Before string
+	// sparse fieldset, the listing selects every field when it is empty
+	Fields        []string
+	FieldSafeList []string // allowed fields
 }
 
 // Next we validate page and PageSize
@@ -23,9 +34,29 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
-	// Check if sort fields provided are valid
-	// We will implement PermittedValue() later
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	// The sort is a comma-separated list of keys, each one optionally
+	// prefixed with - for descending order
+	keys := strings.Split(f.Sort, ",")
+	v.Check(len(keys) <= maxSortKeys, "sort", fmt.Sprintf("must not have more than %d keys", maxSortKeys))
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		v.Check(validator.PermittedValue(key, f.SortSafeList...), "sort", "invalid sort value")
+		v.Check(!seen[strings.TrimPrefix(key, "-")], "sort", "must not repeat a key")
+		seen[strings.TrimPrefix(key, "-")] = true
+	}
+
+	ValidateFields(v, f.Fields, f.FieldSafeList)
+
+	v.Check(f.After == "" || f.Before == "", "before", "cannot be combined with after")
+	for key, value := range map[string]string{"after": f.After, "before": f.Before} {
+		if value == "" {
+			continue
+		}
+		v.Check(f.Page == 1, "page", "cannot be combined with a cursor")
+		if problem := cursorProblem(f, value); problem != "" {
+			v.AddError(key, problem)
+		}
+	}
 }
 
 // define a type to hold the metadata
@@ -35,6 +66,10 @@ type Metadata struct {
 	FirstPage    int `json:"first_page,omitempty"`
 	LastPage     int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+	// cursors for the after and before parameters, only set by listings
+	// that support them
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 // calculate how many records to send back
@@ -63,22 +98,43 @@ func calculateMetaData(totalRecords int, currentPage int, pageSize int) Metadata
 
 }
 
-// Implement the sorting feature
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafeList {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+// sortKeys parses the comma-separated sort into its keys, mapping each
+// sort key to its SQL expression in columns. Keys without an entry are
+// used as plain column names. Keys outside the safe list are refused so
+// nothing the client sent ends up in the query.
+func (f Filters) sortKeys(columns map[string]string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, key := range strings.Split(f.Sort, ",") {
+		if !validator.PermittedValue(key, f.SortSafeList...) {
+			return nil, fmt.Errorf("unsafe sort parameter: %q", key)
 		}
+
+		name := strings.TrimPrefix(key, "-")
+		expression, ok := columns[name]
+		if !ok {
+			expression = name
+		}
+		keys = append(keys, sortKey{expression: expression, descending: strings.HasPrefix(key, "-")})
+	}
+	return keys, nil
+}
+
+// orderBy returns the ORDER BY list for the sort, see sortKeys
+func (f Filters) orderBy(columns map[string]string) (string, error) {
+	keys, err := f.sortKeys(columns)
+	if err != nil {
+		return "", err
 	}
-	// don't allow the operation to continue
-	// if case of SQL injection attack
-	panic("unsafe sort parameter: " + f.Sort)
+	return orderByKeys(keys), nil
 }
 
-// Get the sort order
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+func orderByKeys(keys []sortKey) string {
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = key.expression + " ASC"
+		if key.descending {
+			terms[i] = key.expression + " DESC"
+		}
 	}
-	return "ASC"
+	return strings.Join(terms, ", ")
 }
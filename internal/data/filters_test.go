@@ -0,0 +1,152 @@
+package data
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+var testSortSafeList = []string{"id", "title", "average_rating", "author", "-id", "-title", "-average_rating", "-author"}
+
+func TestSortKeys(t *testing.T) {
+	columns := map[string]string{
+		"average_rating": "COALESCE(b.average_rating, 0)",
+		"author":         "a.name",
+	}
+
+	tests := []struct {
+		sort string
+		want []sortKey
+		err  bool
+	}{
+		{
+			sort: "title",
+			want: []sortKey{{expression: "title"}},
+		},
+		{
+			sort: "-average_rating,title",
+			want: []sortKey{
+				{expression: "COALESCE(b.average_rating, 0)", descending: true},
+				{expression: "title"},
+			},
+		},
+		{
+			sort: "author,-title,id",
+			want: []sortKey{
+				{expression: "a.name"},
+				{expression: "title", descending: true},
+				{expression: "id"},
+			},
+		},
+		{sort: "title,price", err: true},
+		{sort: "title; DROP TABLE books", err: true},
+		{sort: "", err: true},
+	}
+
+	for _, tt := range tests {
+		filters := Filters{Sort: tt.sort, SortSafeList: testSortSafeList}
+		got, err := filters.sortKeys(columns)
+		if tt.err {
+			if err == nil {
+				t.Errorf("sortKeys(%q): expected an error", tt.sort)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sortKeys(%q): unexpected error: %v", tt.sort, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sortKeys(%q) = %+v, want %+v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	filters := Filters{Sort: "-average_rating,title", SortSafeList: testSortSafeList}
+	got, err := filters.orderBy(map[string]string{"title": "b.title"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "average_rating DESC, b.title ASC"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestValidateFiltersSort(t *testing.T) {
+	tests := []struct {
+		sort  string
+		valid bool
+	}{
+		{"title", true},
+		{"-average_rating,title", true},
+		{"author,-title,average_rating,-id", true},
+		{"author,-title,average_rating,-id,title", false}, // too many keys
+		{"title,-title", false},                           // repeated key
+		{"title,title", false},
+		{"title,price", false},
+		{"title,", false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateFilters(v, Filters{Page: 1, PageSize: 10, Sort: tt.sort, SortSafeList: testSortSafeList})
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("ValidateFilters(sort %q): valid = %t, want %t (errors %v)", tt.sort, v.IsEmpty(), tt.valid, v.Errors)
+		}
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	after := cursor{Sort: "title", Values: []string{"Dune"}, ID: 3}.encode()
+
+	tests := []struct {
+		name    string
+		filters Filters
+		errors  []string
+	}{
+		{
+			name:    "after",
+			filters: Filters{Page: 1, PageSize: 10, Sort: "title", After: after},
+		},
+		{
+			name:    "after and before",
+			filters: Filters{Page: 1, PageSize: 10, Sort: "title", After: after, Before: after},
+			errors:  []string{"before"},
+		},
+		{
+			name:    "cursor and page",
+			filters: Filters{Page: 2, PageSize: 10, Sort: "title", After: after},
+			errors:  []string{"page"},
+		},
+		{
+			name:    "cursor for another sort",
+			filters: Filters{Page: 1, PageSize: 10, Sort: "-title", Before: after},
+			errors:  []string{"before"},
+		},
+		{
+			name:    "malformed cursor",
+			filters: Filters{Page: 1, PageSize: 10, Sort: "title", After: "garbage"},
+			errors:  []string{"after"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filters.SortSafeList = testSortSafeList
+			v := validator.New()
+			ValidateFilters(v, tt.filters)
+
+			var got []string
+			for key := range v.Errors {
+				got = append(got, key)
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.errors) {
+				t.Errorf("got errors %v, want errors for %v", v.Errors, tt.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Genre is a node in the genre taxonomy. A genre without a parent is a
+// top-level genre.
+type Genre struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	ParentID *int64 `json:"parent_id"`
+	Version  int32  `json:"version"`
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+var ErrDuplicateSlug = errors.New("duplicate slug")
+var ErrGenreInUse = errors.New("genre in use")
+
+// Slugify turns a genre name into its slug, "Science Fiction" and
+// "science-fiction" both become "science-fiction". Letters and digits of
+// any script are kept, so "Café" becomes "café", and combining marks stay
+// with the letter they follow. This must stay in line with the slugs
+// generated by the genres migration, which has no way to keep the marks.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || (unicode.IsMark(r) && !dash && b.Len() > 0) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// genreAliases folds common abbreviations into the seeded genres, the same
+// way the genres migration did for the existing books
+var genreAliases = map[string]string{
+	"sci-fi":     "science-fiction",
+	"scifi":      "science-fiction",
+	"sf":         "science-fiction",
+	"nonfiction": "non-fiction",
+	"ya":         "young-adult",
+}
+
+// GenreSlug turns the name of a genre given by a client into the slug it
+// is looked up by, so "Sci-Fi" and "SF" find science-fiction
+func GenreSlug(name string) string {
+	slug := Slugify(name)
+	if alias, ok := genreAliases[slug]; ok {
+		return alias
+	}
+	return slug
+}
+
+// ValidateGenre validates the genre fields
+func ValidateGenre(v *validator.Validator, g *Genre) {
+	v.Check(g.Name != "", "name", "must be provided")
+	v.Check(len(g.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(g.Slug != "", "slug", "must contain at least one letter or digit")
+	if g.ParentID != nil {
+		v.Check(*g.ParentID != g.ID, "parent_id", "must not be the genre itself")
+	}
+}
+
+// Insert inserts a new genre
+func (m *GenreModel) Insert(g *Genre) error {
+	query := `
+		INSERT INTO genres (name, slug, parent_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, version
+	`
+	args := []any{g.Name, g.Slug, g.ParentID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&g.ID, &g.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get fetches a genre by ID
+func (m *GenreModel) Get(id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name, slug, parent_id, version
+		FROM genres
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var g Genre
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&g.ID, &g.Name, &g.Slug, &g.ParentID, &g.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// GetBySlugs fetches the genres with the given slugs. Slugs that do not
+// belong to a genre are skipped.
+func (m *GenreModel) GetBySlugs(slugs []string) ([]*Genre, error) {
+	query := `
+		SELECT id, name, slug, parent_id, version
+		FROM genres
+		WHERE slug = ANY($1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(slugs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var genres []*Genre
+	for rows.Next() {
+		var g Genre
+		err := rows.Scan(&g.ID, &g.Name, &g.Slug, &g.ParentID, &g.Version)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// GetByIDs fetches the genres with the given IDs. IDs that do not belong
+// to a genre are skipped.
+func (m *GenreModel) GetByIDs(ids []int64) ([]*Genre, error) {
+	query := `
+		SELECT id, name, slug, parent_id, version
+		FROM genres
+		WHERE id = ANY($1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var genres []*Genre
+	for rows.Next() {
+		var g Genre
+		err := rows.Scan(&g.ID, &g.Name, &g.Slug, &g.ParentID, &g.Version)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Update updates a genre, failing with ErrEditConflict if it was changed
+// since it was read
+func (m *GenreModel) Update(g *Genre) error {
+	query := `
+		UPDATE genres
+		SET name = $1, slug = $2, parent_id = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version
+	`
+	args := []any{g.Name, g.Slug, g.ParentID, g.ID, g.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&g.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateSlug
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a genre that is not assigned to any book. Its children
+// are moved up to the deleted genre's parent.
+func (m *GenreModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM book_genres WHERE genre_id = $1)`, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrGenreInUse
+	}
+
+	query := `
+		UPDATE genres
+		SET parent_id = (SELECT parent_id FROM genres WHERE id = $1), version = version + 1
+		WHERE parent_id = $1
+	`
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// GetAll lists the genres, optionally only the direct children of a parent
+func (m *GenreModel) GetAll(name string, parentID int64, filters Filters) ([]*Genre, Metadata, error) {
+	orderBy, err := filters.orderBy(nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, name, slug, parent_id, version
+		FROM genres
+		WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
+		AND (parent_id = $2 OR $2 = 0)
+		ORDER BY %s, id ASC
+		LIMIT $3 OFFSET $4`, orderBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, parentID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var genres []*Genre
+	totalRecords := 0
+
+	for rows.Next() {
+		var g Genre
+		err := rows.Scan(&totalRecords, &g.ID, &g.Name, &g.Slug, &g.ParentID, &g.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		genres = append(genres, &g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return genres, metadata, nil
+}
+
+// IsDescendant reports whether candidate is id itself or one of its
+// descendants. Making such a genre the parent of id would create a cycle.
+func (m *GenreModel) IsDescendant(id, candidate int64) (bool, error) {
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM genres WHERE id = $1
+			UNION
+			SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+		)
+		SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, id, candidate).Scan(&exists)
+	return exists, err
+}
+
+// ForBook returns the genres assigned to a book, primary genre first
+func (m *GenreModel) ForBook(bookID int64) ([]*Genre, error) {
+	query := `
+		SELECT g.id, g.name, g.slug, g.parent_id, g.version
+		FROM book_genres bg
+		JOIN genres g ON g.id = bg.genre_id
+		JOIN books b ON b.id = bg.book_id
+		WHERE bg.book_id = $1
+		ORDER BY g.name = b.genre DESC, g.name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var g Genre
+		err := rows.Scan(&g.ID, &g.Name, &g.Slug, &g.ParentID, &g.Version)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// SetForBook replaces the genres assigned to a book
+func (m *GenreModel) SetForBook(bookID int64, genreIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setBookGenres(ctx, tx, bookID, genreIDs)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ForBooks returns the genres of each of the books, by book ID, primary
+// genre first
+func (m *GenreModel) ForBooks(bookIDs []int64) (map[int64][]*Genre, error) {
+	query := `
+		SELECT bg.book_id, g.id, g.name, g.slug, g.parent_id, g.version
+		FROM book_genres bg
+		JOIN genres g ON g.id = bg.genre_id
+		JOIN books b ON b.id = bg.book_id
+		WHERE bg.book_id = ANY($1)
+		ORDER BY bg.book_id, g.name = b.genre DESC, g.name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(bookIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := make(map[int64][]*Genre, len(bookIDs))
+	for rows.Next() {
+		var bookID int64
+		var g Genre
+		err := rows.Scan(&bookID, &g.ID, &g.Name, &g.Slug, &g.ParentID, &g.Version)
+		if err != nil {
+			return nil, err
+		}
+		genres[bookID] = append(genres[bookID], &g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
@@ -0,0 +1,53 @@
+package data
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Science Fiction", "science-fiction"},
+		{"science-fiction", "science-fiction"},
+		{"  Self--Help!  ", "self-help"},
+		{"Sci-Fi", "sci-fi"},
+		{"19th Century", "19th-century"},
+		{"Café", "café"},
+		{"Cafe\u0301 Society", "cafe\u0301-society"},
+		{"Ciencia Ficción", "ciencia-ficción"},
+		{"Научная фантастика", "научная-фантастика"},
+		{"推理小説", "推理小説"},
+		{"विज्ञान कथा", "विज्ञान-कथा"},
+		{"\u0301Mark", "mark"},
+		{"!!!", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Slugify(tt.name); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenreSlug(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Sci-Fi", "science-fiction"},
+		{"SciFi", "science-fiction"},
+		{"sf", "science-fiction"},
+		{"YA", "young-adult"},
+		{"Nonfiction", "non-fiction"},
+		{"Non-Fiction", "non-fiction"},
+		{"Fantasy", "fantasy"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := GenreSlug(tt.name); got != tt.want {
+			t.Errorf("GenreSlug(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Outcomes of a single imported row
+const (
+	ImportRowCreated = "created"
+	ImportRowSkipped = "skipped"
+	ImportRowFailed  = "failed"
+)
+
+// ImportRowResult reports what happened to one record of an import
+type ImportRowResult struct {
+	Row    int               `json:"row"` // 1-based, not counting a CSV header
+	Status string            `json:"status"`
+	BookID int64             `json:"book_id,omitempty"`
+	Title  string            `json:"title,omitempty"`
+	ISBN   string            `json:"isbn,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// ImportReport sums up an import, row by row
+type ImportReport struct {
+	DryRun  bool               `json:"dry_run"`
+	Created int                `json:"created"`
+	Skipped int                `json:"skipped"`
+	Failed  int                `json:"failed"`
+	Rows    []*ImportRowResult `json:"rows"`
+}
+
+// Add records the result of a row and updates the totals
+func (r *ImportReport) Add(result *ImportRowResult) {
+	switch result.Status {
+	case ImportRowCreated:
+		r.Created++
+	case ImportRowSkipped:
+		r.Skipped++
+	case ImportRowFailed:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+// ImportJob is an import running in the background
+type ImportJob struct {
+	ID         int64         `json:"id"`
+	UserID     int64         `json:"user_id"`
+	Format     string        `json:"format"`
+	DryRun     bool          `json:"dry_run"`
+	Status     string        `json:"status"` // pending, running, completed or failed
+	Report     *ImportReport `json:"report,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+// Insert records a new pending import job
+func (m *ImportJobModel) Insert(job *ImportJob) error {
+	query := `
+		INSERT INTO import_jobs (user_id, format, dry_run)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, created_at
+	`
+	args := []any{job.UserID, job.Format, job.DryRun}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.Status, &job.CreatedAt)
+}
+
+// Get fetches an import job by ID
+func (m *ImportJobModel) Get(id int64) (*ImportJob, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, format, dry_run, status, report, error, created_at, finished_at
+		FROM import_jobs
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job ImportJob
+	var report []byte
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Format,
+		&job.DryRun,
+		&job.Status,
+		&report,
+		&job.Error,
+		&job.CreatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if report != nil {
+		err = json.Unmarshal(report, &job.Report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// SetRunning marks a job as started
+func (m *ImportJobModel) SetRunning(id int64) error {
+	query := `
+		UPDATE import_jobs
+		SET status = 'running'
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Finish stores the outcome of a job. A non-empty failure marks the whole
+// job as failed, the report then covers the rows processed until then.
+func (m *ImportJobModel) Finish(id int64, report *ImportReport, failure string) error {
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	status := "completed"
+	if failure != "" {
+		status = "failed"
+	}
+
+	query := `
+		UPDATE import_jobs
+		SET status = $1, report = $2, error = $3, finished_at = NOW()
+		WHERE id = $4
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, status, encoded, failure, id)
+	return err
+}
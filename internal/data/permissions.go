@@ -0,0 +1,71 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Permission codes
+const (
+	PermissionBooksAdmin = "books:admin"
+)
+
+// Permissions holds the permission codes of a user
+type Permissions []string
+
+// Include reports whether the code is one of the permissions
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser returns the permissions granted to a user
+func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+		SELECT p.code
+		FROM permissions p
+		JOIN users_permissions up ON up.permission_id = p.id
+		WHERE up.user_id = $1
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+	for rows.Next() {
+		var code string
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, code)
+	}
+
+	return permissions, rows.Err()
+}
+
+// AddForUser grants permissions to a user
+func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	query := `
+		INSERT INTO users_permissions (user_id, permission_id)
+		SELECT $1, p.id FROM permissions p WHERE p.code = ANY($2)
+		ON CONFLICT DO NOTHING
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/lib/pq"
 )
 
 type ReadingList struct {
@@ -48,13 +49,15 @@ func (m *ReadingListModel) Insert(r *ReadingList) error {
 	return m.DB.QueryRowContext(ctx, query, args...).Scan(&r.ID, &r.Version)
 }
 
-func (m *ReadingListModel) Get(id int64) (*ReadingList, error) {
+// Get fetches a reading list, only reading the fields in the fieldset. An
+// empty fieldset reads every field.
+func (m *ReadingListModel) Get(id int64, fields []string) (*ReadingList, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, name, description, created_by, status, version
+		SELECT ` + selectFields(readingListColumns, fields) + `
 		FROM reading_lists
 		WHERE id = $1
 	`
@@ -95,23 +98,54 @@ func (m *ReadingListModel) Delete(id int64) error {
 	_, err := m.DB.ExecContext(ctx, query, id)
 	return err
 }
+
+// readingListSortColumns maps the reading list sort keys to their SQL
+// expressions. A cursor cannot seek past NULLs, so the nullable columns
+// sort as empty.
+var readingListSortColumns = map[string]string{
+	"description": "COALESCE(description, '')",
+	"created_by":  "COALESCE(created_by, 0)",
+	"status":      "COALESCE(status, '')",
+	"book_count":  "(SELECT COUNT(*) FROM reading_lists_books rlb JOIN books b ON b.id = rlb.book_id WHERE rlb.reading_list_id = reading_lists.id AND b.deleted_at IS NULL)",
+}
+
+// readingListColumns are the columns of the reading list listing, in the
+// order they scan
+var readingListColumns = []fieldColumn{
+	{"id", "id", "id"},
+	{"name", "name", "''"},
+	{"description", "description", "''"},
+	{"created_by", "created_by", "0"},
+	{"status", "status", "''"},
+	{"version", "version", "0"},
+}
+
 func (m *ReadingListModel) GetAll(name, description, status string, filters Filters) ([]*ReadingList, Metadata, error) {
+	keys, err := filters.sortKeys(readingListSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	page := newKeyset(filters, keys, "id")
+	seek, seekArgs := page.where(4)
 
-	// Safely format the query string, using the dynamic sort column and direction
+	// Safely format the query string, using the dynamic sort columns and directions
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, name, description, created_by, status, version
+		SELECT %s, %s%s
 		FROM reading_lists
 		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (to_tsvector('simple', description) @@ plainto_tsquery('simple', $2) OR $2 = '')
 		AND (status = $3 OR $3 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+		AND %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, page.countColumn(), selectFields(readingListColumns, filters.Fields), page.keyColumns(), seek, page.orderBy(), 4+len(seekArgs), 5+len(seekArgs))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Pass the result of the function calls (filters.limit() and filters.offset())
-	rows, err := m.DB.QueryContext(ctx, query, name, description, status, filters.limit(), filters.offset())
+	// Pass the paging arguments after the filters and the cursor position
+	args := append([]any{name, description, status}, seekArgs...)
+	args = append(args, page.limit(), page.offset())
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -123,7 +157,7 @@ func (m *ReadingListModel) GetAll(name, description, status string, filters Filt
 	// Loop through the rows and scan the results into the readingLists slice
 	for rows.Next() {
 		var r ReadingList
-		err := rows.Scan(
+		dest := []any{
 			&totalRecords,
 			&r.ID,
 			&r.Name,
@@ -131,7 +165,8 @@ func (m *ReadingListModel) GetAll(name, description, status string, filters Filt
 			&r.CreatedBy,
 			&r.Status,
 			&r.Version,
-		)
+		}
+		err := rows.Scan(append(dest, page.dest(&r.ID)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -143,7 +178,44 @@ func (m *ReadingListModel) GetAll(name, description, status string, filters Filt
 		return nil, Metadata{}, err
 	}
 
-	// Calculate the metadata for pagination (e.g., current page, total pages, etc.)
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	// Trim the page and work out the metadata and cursors for pagination
+	readingLists, metadata := keysetPage(page, readingLists, totalRecords)
 	return readingLists, metadata, nil
 }
+
+// ForBooksByUser returns the user's reading lists each of the books is on,
+// by book ID
+func (m *ReadingListModel) ForBooksByUser(userID int64, bookIDs []int64) (map[int64][]*ReadingList, error) {
+	query := `
+		SELECT rlb.book_id, rl.id, rl.name, rl.description, rl.created_by, rl.status, rl.version
+		FROM reading_lists rl
+		JOIN reading_lists_books rlb ON rlb.reading_list_id = rl.id
+		WHERE rl.created_by = $1 AND rlb.book_id = ANY($2)
+		ORDER BY rlb.book_id, rl.name, rl.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(bookIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := make(map[int64][]*ReadingList, len(bookIDs))
+	for rows.Next() {
+		var bookID int64
+		var r ReadingList
+		err := rows.Scan(&bookID, &r.ID, &r.Name, &r.Description, &r.CreatedBy, &r.Status, &r.Version)
+		if err != nil {
+			return nil, err
+		}
+		lists[bookID] = append(lists[bookID], &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
@@ -11,14 +11,13 @@ type ReadingListBookModel struct {
 	DB *sql.DB
 }
 
-// AddBook adds a book to a reading list
+// AddBook adds a book to a reading list. Adding a book that is already on
+// the list keeps the time it was first added.
 func (m *ReadingListBookModel) AddBook(listID int64, bookID int64) error {
 	query := `
 		INSERT INTO reading_lists_books (reading_list_id, book_id)
-		SELECT $1, $2
-		WHERE NOT EXISTS (
-            SELECT 1 FROM book_authors WHERE book_id = $1 AND author_id = $2
-        )
+		VALUES ($1, $2)
+		ON CONFLICT (reading_list_id, book_id) DO NOTHING
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
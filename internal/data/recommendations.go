@@ -0,0 +1,268 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reasons a book is recommended
+const (
+	RecommendationSimilarReaders = "similar_readers"
+	RecommendationFavouriteGenre = "popular_in_favourite_genres"
+	RecommendationPopular        = "popular"
+)
+
+// Recommendation is a book recommended to a reader. The score is the rating
+// the reader is expected to give it.
+type Recommendation struct {
+	ID            int64   `json:"id"`
+	Title         string  `json:"title"`
+	AverageRating float64 `json:"average_rating"`
+	Score         float64 `json:"score"`
+	Reason        string  `json:"reason"`
+}
+
+type RecommendationModel struct {
+	DB *sql.DB
+}
+
+// recommendationSeen lists the books the reader in $1 reviewed or put on
+// one of their reading lists, which are never recommended
+const recommendationSeen = `
+	listed AS (
+		SELECT DISTINCT rlb.book_id
+		FROM reading_lists rl
+		JOIN reading_lists_books rlb ON rlb.reading_list_id = rl.id
+		WHERE rl.created_by = $1
+	), seen AS (
+		SELECT book_id FROM reviews WHERE user_id = $1
+		UNION
+		SELECT book_id FROM listed
+	)`
+
+// ForUser recommends up to limit books the reader has not seen yet. Books
+// are first predicted from the ratings of readers with a similar taste
+// (item-item collaborative filtering), as of the last run of the
+// recommendations job. Readers without enough ratings get
+// the books popular in their favourite genres, or simply popular books.
+func (m *RecommendationModel) ForUser(userID int64, limit int) ([]*Recommendation, error) {
+	recommendations, err := m.similarReaders(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recommendations) < limit {
+		exclude := make([]int64, len(recommendations))
+		for i, recommendation := range recommendations {
+			exclude[i] = recommendation.ID
+		}
+		popular, err := m.popular(userID, limit-len(recommendations), exclude)
+		if err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, popular...)
+	}
+
+	return recommendations, nil
+}
+
+// maxRatingNeighbours is how many of the books rated most alike are kept
+// for each book
+const maxRatingNeighbours = 50
+
+// ratingSimilarityQuery works out the adjusted cosine similarity of the
+// ratings of every pair of books rated by the same readers, keeping the $1
+// most similar books of each book. Ratings are centered on the mean of the
+// reader. Readers with more than $2 ratings are left out, like broad groups
+// are for the similar books, as each of them pairs up all their books.
+const ratingSimilarityQuery = `
+	WITH means AS (
+		SELECT user_id, AVG(rating) AS mean
+		FROM reviews
+		WHERE rating IS NOT NULL
+		GROUP BY user_id
+		HAVING COUNT(*) <= $2
+	), centered AS (
+		SELECT r.user_id, r.book_id, r.rating - m.mean AS dev
+		FROM reviews r
+		JOIN means m ON m.user_id = r.user_id
+		WHERE r.rating IS NOT NULL
+	), norms AS (
+		SELECT book_id, sqrt(SUM(dev * dev)) AS norm
+		FROM centered
+		GROUP BY book_id
+	), similarities AS (
+		SELECT c1.book_id, c2.book_id AS similar_book_id,
+			SUM(c1.dev * c2.dev) / NULLIF(MIN(n1.norm) * MIN(n2.norm), 0) AS similarity,
+			COUNT(*) AS readers
+		FROM centered c1
+		JOIN centered c2 ON c2.user_id = c1.user_id AND c2.book_id <> c1.book_id
+		JOIN norms n1 ON n1.book_id = c1.book_id
+		JOIN norms n2 ON n2.book_id = c2.book_id
+		GROUP BY c1.book_id, c2.book_id
+		-- a single reader in common says little
+		HAVING COUNT(*) >= 2
+	), ranked AS (
+		SELECT *, ROW_NUMBER() OVER (PARTITION BY book_id ORDER BY similarity DESC, similar_book_id) AS rank
+		FROM similarities
+		WHERE similarity > 0
+	)
+	INSERT INTO book_rating_similarities (book_id, similar_book_id, similarity, readers)
+	SELECT book_id, similar_book_id, similarity, readers
+	FROM ranked
+	WHERE rank <= $1`
+
+// RecomputeSimilarities replaces the rating similarities of the books the
+// recommendations are predicted from, and returns how many were stored
+func (m *RecommendationModel) RecomputeSimilarities(ctx context.Context) (int64, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM book_rating_similarities`)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, ratingSimilarityQuery, maxRatingNeighbours, maxSimilarityGroup)
+	if err != nil {
+		return 0, err
+	}
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return stored, tx.Commit()
+}
+
+// similarReaders predicts the reader's rating of unseen books from how
+// similar they are to the books the reader rated, using the rating
+// similarities worked out by RecomputeSimilarities. Books on the reader's
+// lists that they did not rate count as liked a little. Only books
+// predicted above the reader's average rating are returned.
+func (m *RecommendationModel) similarReaders(userID int64, limit int) ([]*Recommendation, error) {
+	query := fmt.Sprintf(`
+		WITH %s, rated AS (
+			SELECT book_id, rating
+			FROM reviews
+			WHERE user_id = $1 AND rating IS NOT NULL
+		), reader AS (
+			SELECT AVG(rating) AS mean FROM rated
+		), mine AS (
+			SELECT rated.book_id, rated.rating - reader.mean AS dev
+			FROM rated, reader
+			UNION ALL
+			SELECT book_id, 0.5 FROM listed l
+			WHERE NOT EXISTS (SELECT 1 FROM rated WHERE rated.book_id = l.book_id)
+		)
+		SELECT b.id, b.title, COALESCE(b.average_rating, 0),
+			LEAST(5, GREATEST(1, COALESCE((SELECT mean FROM reader), 3)
+				+ SUM(s.similarity * mine.dev) / SUM(s.similarity))) AS score
+		FROM mine
+		JOIN book_rating_similarities s ON s.book_id = mine.book_id
+		JOIN books b ON b.id = s.similar_book_id AND b.deleted_at IS NULL
+		WHERE NOT EXISTS (SELECT 1 FROM seen WHERE seen.book_id = s.similar_book_id)
+		GROUP BY b.id, b.title, b.average_rating
+		HAVING SUM(s.similarity * mine.dev) > 0
+		ORDER BY score DESC, b.id ASC
+		LIMIT $2`, recommendationSeen)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recommendations := []*Recommendation{}
+	for rows.Next() {
+		recommendation := Recommendation{Reason: RecommendationSimilarReaders}
+		err := rows.Scan(&recommendation.ID, &recommendation.Title, &recommendation.AverageRating, &recommendation.Score)
+		if err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, &recommendation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recommendations, nil
+}
+
+// popular returns the best rated unseen books, preferring the genres of the
+// books the reader liked or listed. The rating is a bayesian average, so a
+// book with a single 5 star review does not top the list.
+func (m *RecommendationModel) popular(userID int64, limit int, exclude []int64) ([]*Recommendation, error) {
+	query := fmt.Sprintf(`
+		WITH %s, favourite_genres AS (
+			SELECT bg.genre_id, COUNT(*) AS weight
+			FROM book_genres bg
+			WHERE bg.book_id IN (
+				SELECT book_id FROM reviews WHERE user_id = $1 AND rating >= 4
+				UNION
+				SELECT book_id FROM listed
+			)
+			GROUP BY bg.genre_id
+		), popularity AS (
+			SELECT book_id, COUNT(*) AS reviews, SUM(rating) AS total
+			FROM reviews
+			WHERE rating IS NOT NULL
+			GROUP BY book_id
+		)
+		SELECT b.id, b.title, COALESCE(b.average_rating, 0),
+			(COALESCE(p.total, 0) + 5 * 3.0) / (COALESCE(p.reviews, 0) + 5) AS score,
+			COALESCE((
+				SELECT SUM(fg.weight)
+				FROM book_genres bg
+				JOIN favourite_genres fg ON fg.genre_id = bg.genre_id
+				WHERE bg.book_id = b.id
+			), 0) AS genre_match
+		FROM books b
+		LEFT JOIN popularity p ON p.book_id = b.id
+		WHERE b.deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM seen WHERE seen.book_id = b.id)
+		AND NOT (b.id = ANY($3))
+		ORDER BY genre_match DESC, score DESC, b.id ASC
+		LIMIT $2`, recommendationSeen)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit, pq.Array(exclude))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recommendations := []*Recommendation{}
+	for rows.Next() {
+		var recommendation Recommendation
+		var genreMatch int
+		err := rows.Scan(&recommendation.ID, &recommendation.Title, &recommendation.AverageRating, &recommendation.Score, &genreMatch)
+		if err != nil {
+			return nil, err
+		}
+		recommendation.Reason = RecommendationPopular
+		if genreMatch > 0 {
+			recommendation.Reason = RecommendationFavouriteGenre
+		}
+		recommendations = append(recommendations, &recommendation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recommendations, nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/lib/pq"
 )
 
 // Review represents a review for a book.
@@ -27,6 +28,9 @@ type ReviewModel struct {
 	DB *sql.DB
 }
 
+// ErrDuplicateReview is returned when a user reviews a book twice
+var ErrDuplicateReview = errors.New("duplicate review")
+
 // validate validates the review data.
 func ValidateReview(v *validator.Validator, review *Review) {
 	v.Check(review.Rating > 0, "rating", "must be a positive integer")
@@ -45,10 +49,46 @@ func (m *ReviewModel) Insert(review *Review) error {
 		review.BookID, review.UserID, review.Rating, review.Review,
 	}
 
-	return m.DB.QueryRow(query, args...).Scan(
+	err := m.DB.QueryRow(query, args...).Scan(
 		&review.ID,
 		&review.ReviewDate,
 		&review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_book_user_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Upsert creates the review of a user for a book, or replaces the rating
+// and text of the one they already wrote, dating it anew. created tells
+// which it was.
+func (m *ReviewModel) Upsert(review *Review) (created bool, err error) {
+	query := `
+		INSERT INTO reviews (book_id, user_id, rating, review, review_date)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (book_id, user_id) DO UPDATE
+		SET rating = EXCLUDED.rating, review = EXCLUDED.review, review_date = NOW(), version = reviews.version + 1
+		RETURNING id, review_date, version, xmax = 0
+	`
+	args := []interface{}{
+		review.BookID, review.UserID, review.Rating, review.Review,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// xmax is only zero on a row the statement inserted
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&review.ID,
+		&review.ReviewDate,
+		&review.Version,
+		&created)
+	return created, err
 }
 
 // Get fetches a review by ID.
@@ -135,21 +175,49 @@ func (m *ReviewModel) Delete(id int64) error {
 	return nil
 }
 
+// reviewSortColumns maps the review sort keys to their SQL expressions
+var reviewSortColumns = map[string]string{
+	"rating": "COALESCE(rating, 0)",
+}
+
+// reviewColumns are the columns of the review listing, in the order they scan
+var reviewColumns = []fieldColumn{
+	{"id", "id", "id"},
+	{"book_id", "book_id", "0"},
+	{"user_id", "user_id", "0"},
+	{"rating", "rating", "0"},
+	{"review", "review", "''"},
+	{"review_date", "review_date", "'0001-01-01'::timestamptz"},
+	{"version", "version", "0"},
+}
+
 // get all reviews for specific book
 func (m *ReviewModel) GetAll(bookID int64, rating int, review string, filters Filters) ([]*Review, Metadata, error) {
+	keys, err := filters.sortKeys(reviewSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	page := newKeyset(filters, keys, "id")
+	seek, seekArgs := page.where(4)
+
 	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, book_id, user_id, rating, review, review_date, version
+        SELECT %s, %s%s
         FROM reviews
         WHERE book_id = $1
+        AND EXISTS (SELECT 1 FROM books b WHERE b.id = reviews.book_id AND b.deleted_at IS NULL)
         AND (rating = $2 OR $2 = 0)
         AND (review ILIKE '%%' || $3 || '%%' OR $3 = '')  -- filtering based on review content
-        ORDER BY %s %s, id ASC
-        LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+        AND %s
+        ORDER BY %s
+        LIMIT $%d OFFSET $%d`, page.countColumn(), selectFields(reviewColumns, filters.Fields), page.keyColumns(), seek, page.orderBy(), 4+len(seekArgs), 5+len(seekArgs))
+
+	args := append([]any{bookID, rating, review}, seekArgs...)
+	args = append(args, page.limit(), page.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, bookID, rating, review, filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -160,7 +228,7 @@ func (m *ReviewModel) GetAll(bookID int64, rating int, review string, filters Fi
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(
+		dest := []any{
 			&totalRecords,
 			&review.ID,
 			&review.BookID,
@@ -169,7 +237,8 @@ func (m *ReviewModel) GetAll(bookID int64, rating int, review string, filters Fi
 			&review.Review,
 			&review.ReviewDate,
 			&review.Version,
-		)
+		}
+		err := rows.Scan(append(dest, page.dest(&review.ID)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -180,6 +249,79 @@ func (m *ReviewModel) GetAll(bookID int64, rating int, review string, filters Fi
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	reviews, metadata := keysetPage(page, reviews, totalRecords)
 	return reviews, metadata, nil
 }
+
+// RecentForBooks returns the latest reviews of each of the books, at most
+// perBook of them, by book ID
+func (m *ReviewModel) RecentForBooks(bookIDs []int64, perBook int) (map[int64][]*Review, error) {
+	query := `
+		SELECT id, book_id, user_id, rating, review, review_date, version
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY book_id ORDER BY review_date DESC, id DESC) AS rank
+			FROM reviews
+			WHERE book_id = ANY($1)
+		) r
+		WHERE rank <= $2
+		ORDER BY book_id, rank
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(bookIDs), perBook)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make(map[int64][]*Review, len(bookIDs))
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.Review, &review.ReviewDate, &review.Version)
+		if err != nil {
+			return nil, err
+		}
+		reviews[review.BookID] = append(reviews[review.BookID], &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// ForBooksByUser returns the user's review of each of the books they
+// reviewed, by book ID.
+func (m *ReviewModel) ForBooksByUser(userID int64, bookIDs []int64) (map[int64]*Review, error) {
+	query := `
+		SELECT id, book_id, user_id, rating, review, review_date, version
+		FROM reviews
+		WHERE user_id = $1 AND book_id = ANY($2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(bookIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make(map[int64]*Review, len(bookIDs))
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.Review, &review.ReviewDate, &review.Version)
+		if err != nil {
+			return nil, err
+		}
+		reviews[review.BookID] = &review
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
@@ -0,0 +1,229 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Revision actions
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionRevert  = "revert"
+	RevisionDelete  = "delete"  // moved to the trash
+	RevisionRestore = "restore" // taken out of the trash
+)
+
+// BookSnapshot is the editable state of a book at one point in time. The
+// book revisions migration builds the same JSON for the existing books,
+// without the genre IDs and cover version, so reverts to those snapshots
+// look the genres up by name. A cover is only recorded by its version, the
+// image itself can not be reverted.
+type BookSnapshot struct {
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	ISBN            string   `json:"isbn"`
+	PublicationDate string   `json:"publication_date"`
+	Genre           string   `json:"genre"`
+	Genres          []string `json:"genres"`
+	GenreIDs        []int64  `json:"genre_ids"`
+	Description     string   `json:"description"`
+	SeriesID        *int64   `json:"series_id"`
+	SeriesPosition  *float64 `json:"series_position"`
+	CoverVersion    int32    `json:"cover_version"`
+}
+
+// FieldChange holds the value of a field before and after a revision
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// DiffBookSnapshots returns the fields that differ between two snapshots,
+// keyed by their JSON name. A nil before snapshot counts as all null.
+func DiffBookSnapshots(before, after *BookSnapshot) (map[string]FieldChange, error) {
+	fields := func(snapshot *BookSnapshot) (map[string]json.RawMessage, error) {
+		values := map[string]json.RawMessage{}
+		if snapshot == nil {
+			return values, nil
+		}
+		encoded, err := json.Marshal(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(encoded, &values)
+		return values, err
+	}
+
+	from, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	null := json.RawMessage("null")
+	changes := map[string]FieldChange{}
+	for name, value := range to {
+		previous, ok := from[name]
+		if !ok {
+			previous = null
+		}
+		if !bytes.Equal(previous, value) {
+			changes[name] = FieldChange{From: previous, To: value}
+		}
+	}
+	return changes, nil
+}
+
+// BookRevision is one change to a book
+type BookRevision struct {
+	ID           int64                  `json:"id"`
+	BookID       int64                  `json:"book_id"`
+	BookVersion  int32                  `json:"book_version"`
+	UserID       *int64                 `json:"user_id"` // nil for changes made by the system
+	Username     string                 `json:"username,omitempty"`
+	Action       string                 `json:"action"`
+	Changes      map[string]FieldChange `json:"changes"`
+	Snapshot     *BookSnapshot          `json:"snapshot"`
+	RevertedFrom *int64                 `json:"reverted_from,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// insertRevision records a revision and fills in its ID and creation time
+func insertRevision(ctx context.Context, q dbtx, revision *BookRevision) error {
+	changes, err := json.Marshal(revision.Changes)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(revision.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO book_revisions (book_id, book_version, user_id, action, changes, snapshot, reverted_from)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	args := []any{revision.BookID, revision.BookVersion, revision.UserID, revision.Action, changes, snapshot, revision.RevertedFrom}
+
+	return q.QueryRowContext(ctx, query, args...).Scan(&revision.ID, &revision.CreatedAt)
+}
+
+const revisionColumns = `r.id, r.book_id, r.book_version, r.user_id, COALESCE(u.username, ''), r.action,
+	r.changes, r.snapshot, r.reverted_from, r.created_at`
+
+// scanRevision scans a row selected with revisionColumns, after the
+// destinations given in extra
+func scanRevision(scanner interface{ Scan(...any) error }, extra ...any) (*BookRevision, error) {
+	var revision BookRevision
+	var changes, snapshot []byte
+
+	dest := append(extra,
+		&revision.ID,
+		&revision.BookID,
+		&revision.BookVersion,
+		&revision.UserID,
+		&revision.Username,
+		&revision.Action,
+		&changes,
+		&snapshot,
+		&revision.RevertedFrom,
+		&revision.CreatedAt,
+	)
+	err := scanner.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(changes, &revision.Changes)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(snapshot, &revision.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// Get fetches a revision of a book
+func (m *RevisionModel) Get(bookID, id int64) (*BookRevision, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM book_revisions r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.book_id = $1 AND r.id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	revision, err := scanRevision(m.DB.QueryRowContext(ctx, query, bookID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return revision, nil
+}
+
+// GetAllForBook lists the revisions of a book in ID order
+func (m *RevisionModel) GetAllForBook(bookID int64, filters Filters) ([]*BookRevision, Metadata, error) {
+	orderBy, err := filters.orderBy(map[string]string{"id": "r.id"})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM book_revisions r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.book_id = $1
+		ORDER BY %s
+		LIMIT $2 OFFSET $3`, revisionColumns, orderBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	revisions := []*BookRevision{}
+	totalRecords := 0
+
+	for rows.Next() {
+		revision, err := scanRevision(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return revisions, metadata, nil
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffBookSnapshots(t *testing.T) {
+	seriesID := int64(3)
+	position := 2.5
+
+	base := func() *BookSnapshot {
+		return &BookSnapshot{
+			Title:           "Dune",
+			Authors:         []string{"Frank Herbert"},
+			ISBN:            "9780441172719",
+			PublicationDate: "1965-08-01",
+			Genre:           "Science Fiction",
+			Genres:          []string{"Science Fiction"},
+			GenreIDs:        []int64{1},
+			Description:     "Spice.",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		before *BookSnapshot
+		after  func(*BookSnapshot)
+		want   map[string]FieldChange
+	}{
+		{
+			name:   "no change",
+			before: base(),
+			after:  func(*BookSnapshot) {},
+			want:   map[string]FieldChange{},
+		},
+		{
+			name:   "title",
+			before: base(),
+			after:  func(s *BookSnapshot) { s.Title = "Dune Messiah" },
+			want: map[string]FieldChange{
+				"title": {From: json.RawMessage(`"Dune"`), To: json.RawMessage(`"Dune Messiah"`)},
+			},
+		},
+		{
+			name:   "authors and genres",
+			before: base(),
+			after: func(s *BookSnapshot) {
+				s.Authors = []string{"Brian Herbert", "Frank Herbert"}
+				s.Genres = []string{"Science Fiction", "Classics"}
+				s.GenreIDs = []int64{1, 7}
+			},
+			want: map[string]FieldChange{
+				"authors":   {From: json.RawMessage(`["Frank Herbert"]`), To: json.RawMessage(`["Brian Herbert","Frank Herbert"]`)},
+				"genres":    {From: json.RawMessage(`["Science Fiction"]`), To: json.RawMessage(`["Science Fiction","Classics"]`)},
+				"genre_ids": {From: json.RawMessage(`[1]`), To: json.RawMessage(`[1,7]`)},
+			},
+		},
+		{
+			name:   "series and cover",
+			before: base(),
+			after: func(s *BookSnapshot) {
+				s.SeriesID = &seriesID
+				s.SeriesPosition = &position
+				s.CoverVersion = 1
+			},
+			want: map[string]FieldChange{
+				"series_id":       {From: json.RawMessage(`null`), To: json.RawMessage(`3`)},
+				"series_position": {From: json.RawMessage(`null`), To: json.RawMessage(`2.5`)},
+				"cover_version":   {From: json.RawMessage(`0`), To: json.RawMessage(`1`)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := base()
+			tt.after(after)
+
+			got, err := DiffBookSnapshots(tt.before, after)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffBookSnapshotsNew(t *testing.T) {
+	after := &BookSnapshot{Title: "Emma", Authors: []string{}, Genres: []string{}, GenreIDs: []int64{}}
+
+	got, err := DiffBookSnapshots(nil, after)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// every field of a new book changes from null, except those that are
+	// null themselves
+	for _, name := range []string{"title", "authors", "isbn", "genre_ids", "cover_version"} {
+		change, ok := got[name]
+		if !ok {
+			t.Errorf("missing change for %q", name)
+			continue
+		}
+		if string(change.From) != "null" {
+			t.Errorf("%q changed from %s, want null", name, change.From)
+		}
+	}
+	for _, name := range []string{"series_id", "series_position"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("unexpected change for %q", name)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Series groups books that are read in order
+type Series struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	BookCount   int       `json:"book_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	Version     int32     `json:"version"`
+}
+
+// SeriesBook is a book as listed in its series
+type SeriesBook struct {
+	ID              int64     `json:"id"`
+	Title           string    `json:"title"`
+	Position        *float64  `json:"position"` // nil for books without a number
+	PublicationDate time.Time `json:"publication_date"`
+	AverageRating   float64   `json:"average_rating"`
+}
+
+// BookSeries is the series a book is in, with its place in it
+type BookSeries struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Position *float64 `json:"position"`
+}
+
+type SeriesModel struct {
+	DB *sql.DB
+}
+
+// ValidateSeries validates the series fields
+func ValidateSeries(v *validator.Validator, s *Series) {
+	v.Check(s.Name != "", "name", "must be provided")
+	v.Check(len(s.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(s.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+}
+
+// ValidateSeriesPosition validates the position of a book in its series
+func ValidateSeriesPosition(v *validator.Validator, position float64) {
+	v.Check(position >= 0, "series_position", "must not be negative")
+	v.Check(position < 100000, "series_position", "must be less than 100000")
+	// the column holds three decimals and would round anything finer
+	thousandths := position * 1000
+	v.Check(math.Abs(thousandths-math.Round(thousandths)) < 1e-6, "series_position", "must not have more than three decimal places")
+}
+
+// Insert inserts a new series
+func (m *SeriesModel) Insert(s *Series) error {
+	query := `
+		INSERT INTO series (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, s.Name, s.Description).Scan(&s.ID, &s.CreatedAt, &s.Version)
+}
+
+// Get fetches a series by ID
+func (m *SeriesModel) Get(id int64) (*Series, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT s.id, s.name, s.description, s.created_at, s.version,
+			(SELECT COUNT(*) FROM books b WHERE b.series_id = s.id AND b.deleted_at IS NULL)
+		FROM series s
+		WHERE s.id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s Series
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&s.ID, &s.Name, &s.Description, &s.CreatedAt, &s.Version, &s.BookCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Update updates a series, failing with ErrEditConflict if it was changed
+// since it was read
+func (m *SeriesModel) Update(s *Series) error {
+	query := `
+		UPDATE series
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version
+	`
+	args := []any{s.Name, s.Description, s.ID, s.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&s.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a series, its books stay in the catalogue on their own.
+// The change to each book is recorded as a revision made by the user.
+func (m *SeriesModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM books WHERE series_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return err
+	}
+	var bookIDs []int64
+	for rows.Next() {
+		var bookID int64
+		err := rows.Scan(&bookID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		bookIDs = append(bookIDs, bookID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	before := make([]*BookSnapshot, len(bookIDs))
+	for i, bookID := range bookIDs {
+		before[i], _, err = bookSnapshot(ctx, tx, bookID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE books
+		SET series_id = NULL, series_position = NULL, version = version + 1
+		WHERE series_id = $1
+	`
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM series WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	for i, bookID := range bookIDs {
+		_, err = recordBookRevision(ctx, tx, bookID, &userID, RevisionUpdate, before[i], nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAll lists the series, optionally filtered by name
+func (m *SeriesModel) GetAll(name string, filters Filters) ([]*Series, Metadata, error) {
+	orderBy, err := filters.orderBy(nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), s.id, s.name, s.description, s.created_at, s.version,
+			(SELECT COUNT(*) FROM books b WHERE b.series_id = s.id AND b.deleted_at IS NULL)
+		FROM series s
+		WHERE (s.name ILIKE '%%' || $1 || '%%' OR $1 = '')
+		ORDER BY %s, s.id ASC
+		LIMIT $2 OFFSET $3`, orderBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	series := []*Series{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var s Series
+		err := rows.Scan(&totalRecords, &s.ID, &s.Name, &s.Description, &s.CreatedAt, &s.Version, &s.BookCount)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		series = append(series, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return series, metadata, nil
+}
+
+// Books returns the books of a series in reading order
+func (m *SeriesModel) Books(seriesID int64) ([]*SeriesBook, error) {
+	query := `
+		SELECT id, title, series_position, publication_date, average_rating
+		FROM books
+		WHERE series_id = $1 AND deleted_at IS NULL
+		ORDER BY series_position ASC NULLS LAST, publication_date ASC, id ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*SeriesBook{}
+	for rows.Next() {
+		var book SeriesBook
+		err := rows.Scan(&book.ID, &book.Title, &book.Position, &book.PublicationDate, &book.AverageRating)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// ForBooks returns the series of each of the books that are in one, by
+// book ID
+func (m *SeriesModel) ForBooks(bookIDs []int64) (map[int64]*BookSeries, error) {
+	query := `
+		SELECT b.id, s.id, s.name, b.series_position
+		FROM books b
+		JOIN series s ON s.id = b.series_id
+		WHERE b.id = ANY($1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(bookIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := make(map[int64]*BookSeries, len(bookIDs))
+	for rows.Next() {
+		var bookID int64
+		var s BookSeries
+		err := rows.Scan(&bookID, &s.ID, &s.Name, &s.Position)
+		if err != nil {
+			return nil, err
+		}
+		series[bookID] = &s
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+func TestValidateSeriesPosition(t *testing.T) {
+	tests := []struct {
+		position float64
+		valid    bool
+	}{
+		{0, true},
+		{1, true},
+		{1.5, true},
+		{2.25, true},
+		{0.001, true},
+		{12.345, true},
+		{99999.999, true},
+		{1.0005, false},
+		{0.1234, false},
+		{-1, false},
+		{100000, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateSeriesPosition(v, tt.position)
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("ValidateSeriesPosition(%v): valid = %t, want %t (errors %v)", tt.position, v.IsEmpty(), tt.valid, v.Errors)
+		}
+	}
+}
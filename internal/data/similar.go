@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MaxSimilarBooks is how many similar books are kept for each book
+const MaxSimilarBooks = 20
+
+// maxSimilarityGroup is the most books a genre, tag, reading list or
+// reader can have and still count towards similarity. Pairing up every
+// book of a broad genre says little and grows with the square of its size.
+const maxSimilarityGroup = 200
+
+// SimilarBook is a book similar to another one, with what they share
+type SimilarBook struct {
+	ID              int64   `json:"id"`
+	Title           string  `json:"title"`
+	AverageRating   float64 `json:"average_rating"`
+	Score           float64 `json:"score"`
+	SharedAuthors   int     `json:"shared_authors"`
+	SharedGenres    int     `json:"shared_genres"`
+	SharedTags      int     `json:"shared_tags"`
+	SharedLists     int     `json:"shared_lists"`     // reading lists with both books
+	SharedReviewers int     `json:"shared_reviewers"` // readers who rated both 4 or more
+}
+
+type SimilarityModel struct {
+	DB *sql.DB
+}
+
+// similarityQuery scores every pair of books that have something in
+// common and keeps the best ones for each book. Authors weigh the most,
+// then readers who liked both, then lists and genres. The list and reader
+// counts are dampened so a few popular books do not crowd out the rest.
+// $1 limits the books scored, 0 scores the whole catalogue. Genres, tags,
+// lists and readers with more than $3 books are left out.
+const similarityQuery = `
+	WITH narrow_genres AS (
+		SELECT genre_id FROM book_genres GROUP BY genre_id HAVING COUNT(*) <= $3
+	), narrow_tags AS (
+		SELECT tag_id FROM book_tags GROUP BY tag_id HAVING COUNT(DISTINCT book_id) <= $3
+	), narrow_lists AS (
+		SELECT reading_list_id FROM reading_lists_books GROUP BY reading_list_id HAVING COUNT(*) <= $3
+	), narrow_readers AS (
+		SELECT user_id FROM reviews WHERE rating >= 4 GROUP BY user_id HAVING COUNT(*) <= $3
+	), pairs AS (
+		SELECT a1.book_id, a2.book_id AS similar_book_id, 'author' AS kind
+		FROM book_authors a1
+		JOIN book_authors a2 ON a2.author_id = a1.author_id AND a2.book_id <> a1.book_id
+		WHERE a1.book_id = $1 OR $1 = 0
+		UNION ALL
+		SELECT g1.book_id, g2.book_id, 'genre'
+		FROM book_genres g1
+		JOIN narrow_genres USING (genre_id)
+		JOIN book_genres g2 ON g2.genre_id = g1.genre_id AND g2.book_id <> g1.book_id
+		WHERE g1.book_id = $1 OR $1 = 0
+		UNION ALL
+		SELECT t1.book_id, t2.book_id, 'tag'
+		FROM (SELECT DISTINCT book_id, tag_id FROM book_tags) t1
+		JOIN narrow_tags USING (tag_id)
+		JOIN (SELECT DISTINCT book_id, tag_id FROM book_tags) t2 ON t2.tag_id = t1.tag_id AND t2.book_id <> t1.book_id
+		WHERE t1.book_id = $1 OR $1 = 0
+		UNION ALL
+		SELECT l1.book_id, l2.book_id, 'list'
+		FROM reading_lists_books l1
+		JOIN narrow_lists USING (reading_list_id)
+		JOIN reading_lists_books l2 ON l2.reading_list_id = l1.reading_list_id AND l2.book_id <> l1.book_id
+		WHERE l1.book_id = $1 OR $1 = 0
+		UNION ALL
+		SELECT r1.book_id, r2.book_id, 'reviewer'
+		FROM reviews r1
+		JOIN narrow_readers USING (user_id)
+		JOIN reviews r2 ON r2.user_id = r1.user_id AND r2.book_id <> r1.book_id
+		WHERE r1.rating >= 4 AND r2.rating >= 4 AND (r1.book_id = $1 OR $1 = 0)
+	), counted AS (
+		SELECT p.book_id, p.similar_book_id,
+			COUNT(*) FILTER (WHERE kind = 'author') AS shared_authors,
+			COUNT(*) FILTER (WHERE kind = 'genre') AS shared_genres,
+			COUNT(*) FILTER (WHERE kind = 'tag') AS shared_tags,
+			COUNT(*) FILTER (WHERE kind = 'list') AS shared_lists,
+			COUNT(*) FILTER (WHERE kind = 'reviewer') AS shared_reviewers
+		FROM pairs p
+		JOIN books b ON b.id = p.book_id AND b.deleted_at IS NULL
+		JOIN books s ON s.id = p.similar_book_id AND s.deleted_at IS NULL
+		GROUP BY p.book_id, p.similar_book_id
+	), scored AS (
+		SELECT *,
+			3 * shared_authors + shared_genres + 0.5 * shared_tags
+				+ 1.5 * ln(1 + shared_lists) + 2 * ln(1 + shared_reviewers) AS score
+		FROM counted
+	), ranked AS (
+		SELECT *, ROW_NUMBER() OVER (PARTITION BY book_id ORDER BY score DESC, similar_book_id) AS rank
+		FROM scored
+	)
+	INSERT INTO book_similarities (book_id, similar_book_id, score,
+		shared_authors, shared_genres, shared_tags, shared_lists, shared_reviewers)
+	SELECT book_id, similar_book_id, score,
+		shared_authors, shared_genres, shared_tags, shared_lists, shared_reviewers
+	FROM ranked
+	WHERE rank <= $2`
+
+// Recompute replaces the cached similar books of a book, or of every book
+// when bookID is 0, and returns how many were stored. The books are marked
+// as scored even when nothing similar was found.
+func (m *SimilarityModel) Recompute(ctx context.Context, bookID int64) (int64, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM book_similarities WHERE book_id = $1 OR $1 = 0`, bookID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, similarityQuery, bookID, MaxSimilarBooks, maxSimilarityGroup)
+	if err != nil {
+		return 0, err
+	}
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO book_similarity_runs (book_id, computed_at)
+		SELECT id, NOW()
+		FROM books
+		WHERE (id = $1 OR $1 = 0) AND deleted_at IS NULL
+		ON CONFLICT (book_id) DO UPDATE SET computed_at = EXCLUDED.computed_at
+	`
+	_, err = tx.ExecContext(ctx, query, bookID)
+	if err != nil {
+		return 0, err
+	}
+
+	return stored, tx.Commit()
+}
+
+// Scored reports whether the similar books of a book have been worked out,
+// either by the similar books job or on request
+func (m *SimilarityModel) Scored(bookID int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var scored bool
+	err := m.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM book_similarity_runs WHERE book_id = $1)`, bookID).Scan(&scored)
+	return scored, err
+}
+
+// ForBook returns the cached books most similar to a book, best first
+func (m *SimilarityModel) ForBook(bookID int64, limit int) ([]*SimilarBook, error) {
+	query := `
+		SELECT s.id, s.title, COALESCE(s.average_rating, 0), bs.score,
+			bs.shared_authors, bs.shared_genres, bs.shared_tags, bs.shared_lists, bs.shared_reviewers
+		FROM book_similarities bs
+		JOIN books s ON s.id = bs.similar_book_id
+		WHERE bs.book_id = $1 AND s.deleted_at IS NULL
+		ORDER BY bs.score DESC, s.id ASC
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*SimilarBook{}
+	for rows.Next() {
+		var book SimilarBook
+		err := rows.Scan(&book.ID, &book.Title, &book.AverageRating, &book.Score,
+			&book.SharedAuthors, &book.SharedGenres, &book.SharedTags, &book.SharedLists, &book.SharedReviewers)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// BookStats describes the reviews of a book. The median, standard deviation
+// and review dates are nil while the book has no rated reviews.
+type BookStats struct {
+	BookID        int64          `json:"book_id"`
+	AverageRating float64        `json:"average_rating"`
+	ReviewCount   int            `json:"review_count"`
+	Histogram     map[string]int `json:"histogram"` // reviews per rating, "1" to "5"
+	Median        *float64       `json:"median"`
+	StdDev        *float64       `json:"stddev"`
+	ListCount     int            `json:"list_count"` // reading lists with the book
+	FirstReviewAt *time.Time     `json:"first_review_at"`
+	LastReviewAt  *time.Time     `json:"last_review_at"`
+}
+
+// Stats works out the review statistics of a book
+func (m BookModel) Stats(bookID int64) (*BookStats, error) {
+	query := `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE rating = 1),
+			COUNT(*) FILTER (WHERE rating = 2),
+			COUNT(*) FILTER (WHERE rating = 3),
+			COUNT(*) FILTER (WHERE rating = 4),
+			COUNT(*) FILTER (WHERE rating = 5),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY rating),
+			stddev_pop(rating),
+			MIN(review_date),
+			MAX(review_date),
+			(SELECT COUNT(*) FROM reading_lists_books WHERE book_id = $1)
+		FROM reviews
+		WHERE book_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stats := BookStats{BookID: bookID}
+	var histogram [5]int
+	err := m.DB.QueryRowContext(ctx, query, bookID).Scan(
+		&stats.ReviewCount,
+		&histogram[0],
+		&histogram[1],
+		&histogram[2],
+		&histogram[3],
+		&histogram[4],
+		&stats.Median,
+		&stats.StdDev,
+		&stats.FirstReviewAt,
+		&stats.LastReviewAt,
+		&stats.ListCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Histogram = map[string]int{"1": histogram[0], "2": histogram[1], "3": histogram[2], "4": histogram[3], "5": histogram[4]}
+	return &stats, nil
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Suggestion is a book, author or series matching what a user is typing
+type Suggestion struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"` // the title of a book
+}
+
+// Suggestions holds the best matches of each kind
+type Suggestions struct {
+	Books   []*Suggestion `json:"books"`
+	Authors []*Suggestion `json:"authors"`
+	Series  []*Suggestion `json:"series"`
+}
+
+type SuggestModel struct {
+	DB *sql.DB
+}
+
+// likeEscaper escapes the characters that are special in a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit books, authors and series whose name starts
+// with the text or resembles it, the names starting with it first. The
+// trigram indexes keep it fast enough to run on every keystroke.
+func (m SuggestModel) Suggest(text string, limit int) (*Suggestions, error) {
+	query := `
+		(
+			SELECT 'book', id, title
+			FROM books
+			WHERE deleted_at IS NULL AND (title ILIKE $3 || '%' ESCAPE '\' OR $1 <% title)
+			ORDER BY title ILIKE $3 || '%' ESCAPE '\' DESC, word_similarity($1, title) DESC, title
+			LIMIT $2
+		)
+		UNION ALL
+		(
+			SELECT 'author', id, name
+			FROM authors
+			WHERE name ILIKE $3 || '%' ESCAPE '\' OR $1 <% name
+			ORDER BY name ILIKE $3 || '%' ESCAPE '\' DESC, word_similarity($1, name) DESC, name
+			LIMIT $2
+		)
+		UNION ALL
+		(
+			SELECT 'series', id, name
+			FROM series
+			WHERE name ILIKE $3 || '%' ESCAPE '\' OR $1 <% name
+			ORDER BY name ILIKE $3 || '%' ESCAPE '\' DESC, word_similarity($1, name) DESC, name
+			LIMIT $2
+		)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, text, limit, likeEscaper.Replace(text))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := &Suggestions{Books: []*Suggestion{}, Authors: []*Suggestion{}, Series: []*Suggestion{}}
+	for rows.Next() {
+		var kind string
+		var suggestion Suggestion
+		err := rows.Scan(&kind, &suggestion.ID, &suggestion.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "book":
+			suggestions.Books = append(suggestions.Books, &suggestion)
+		case "author":
+			suggestions.Authors = append(suggestions.Authors, &suggestion)
+		case "series":
+			suggestions.Series = append(suggestions.Series, &suggestion)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,22 @@
+package data
+
+import "testing"
+
+func TestLikeEscaper(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Dune", "Dune"},
+		{"%%", `\%\%`},
+		{"snake_case", `snake\_case`},
+		{`C:\books`, `C:\\books`},
+		{`100%_\`, `100\%\_\\`},
+	}
+
+	for _, tt := range tests {
+		if got := likeEscaper.Replace(tt.text); got != tt.want {
+			t.Errorf("likeEscaper.Replace(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Tag is a free-form label members put on books. Tag names are stored in
+// their slug form so "Book Club 2026" and "book-club-2026" are one tag.
+type Tag struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// TagCount is a tag with the number of books it was put on
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// BookTag is a tag on a single book with the number of members who used it
+type BookTag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Mine  bool   `json:"mine"` // the current user tagged the book with it
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// ValidateTags validates the tag names of a tagging request
+func ValidateTags(v *validator.Validator, names []string) {
+	v.Check(len(names) > 0, "tags", "must contain at least one tag")
+	v.Check(len(names) <= 20, "tags", "must not contain more than 20 tags")
+	for _, name := range names {
+		v.Check(Slugify(name) != "", "tags", "must contain at least one letter or digit")
+		v.Check(len(name) <= 50, "tags", "must not be more than 50 bytes long")
+	}
+}
+
+// tagSlugs turns tag names into their slugs, dropping the ones that
+// collapse into a slug already seen, so "Fantasy" and "fantasy" count once
+func tagSlugs(names []string) []string {
+	slugs := make([]string, 0, len(names))
+	for _, name := range names {
+		slug := Slugify(name)
+		if slug != "" && !slices.Contains(slugs, slug) {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+// AddToBook tags a book on behalf of a user, creating tags that do not
+// exist yet. Tags the user already put on the book are left alone.
+func (m *TagModel) AddToBook(bookID, userID int64, names []string) error {
+	slugs := tagSlugs(names)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO tags (name)
+		SELECT DISTINCT unnest($1::text[])
+		ON CONFLICT (name) DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query, pq.Array(slugs))
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO book_tags (book_id, tag_id, user_id)
+		SELECT $1, id, $2
+		FROM tags
+		WHERE name = ANY($3)
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query, bookID, userID, pq.Array(slugs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveFromBook removes a tag the user put on a book
+func (m *TagModel) RemoveFromBook(bookID, userID int64, name string) error {
+	query := `
+		DELETE FROM book_tags
+		WHERE book_id = $1 AND user_id = $2
+		AND tag_id = (SELECT id FROM tags WHERE name = $3)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, bookID, userID, Slugify(name))
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ForBook returns the tags on a book, most used first, flagging the ones
+// the given user applied
+func (m *TagModel) ForBook(bookID, userID int64) ([]*BookTag, error) {
+	query := `
+		SELECT t.name, COUNT(*), bool_or(bt.user_id = $2)
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.book_id = $1
+		GROUP BY t.name
+		ORDER BY COUNT(*) DESC, t.name
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*BookTag{}
+	for rows.Next() {
+		var tag BookTag
+		err := rows.Scan(&tag.Name, &tag.Count, &tag.Mine)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Cloud counts the number of books each tag was put on, most used first.
+// When userID is set only that user's tags are counted.
+func (m *TagModel) Cloud(userID int64, limit int) ([]*TagCount, error) {
+	query := `
+		SELECT t.name, COUNT(DISTINCT bt.book_id)
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		JOIN books b ON b.id = bt.book_id
+		WHERE (bt.user_id = $1 OR $1 = 0)
+		AND b.deleted_at IS NULL
+		GROUP BY t.name
+		ORDER BY COUNT(DISTINCT bt.book_id) DESC, t.name
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		err := rows.Scan(&tag.Name, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+func TestTagSlugs(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"none", nil, []string{}},
+		{"slugged", []string{"Book Club 2026", "Cozy"}, []string{"book-club-2026", "cozy"}},
+		{"case duplicates", []string{"Fantasy", "fantasy", "FANTASY"}, []string{"fantasy"}},
+		{"spelling duplicates", []string{"to-read", "To Read", "to_read"}, []string{"to-read"}},
+		{"empty slugs dropped", []string{"!!", "dark"}, []string{"dark"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tagSlugs(tt.names); !slices.Equal(got, tt.want) {
+				t.Errorf("tagSlugs(%q) = %q, want %q", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBookCriteriaTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  []string
+		valid bool
+	}{
+		{"no tags", nil, true},
+		{"tags", []string{"Fantasy", "cozy"}, true},
+		{"empty slug", []string{"fantasy", "---"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateBookCriteria(v, BookCriteria{Tags: tt.tags, TagMatch: "all"})
+			if v.IsEmpty() != tt.valid {
+				t.Errorf("valid = %t, want %t (errors %v)", v.IsEmpty(), tt.valid, v.Errors)
+			}
+		})
+	}
+}
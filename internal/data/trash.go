@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeletedBook is a book in the trash
+type DeletedBook struct {
+	Book
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// GetTrash lists the deleted books that were not purged yet
+func (m *BookModel) GetTrash(title string, filters Filters) ([]*DeletedBook, Metadata, error) {
+	orderBy, err := filters.orderBy(nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, title, isbn, publication_date, genre, description, average_rating,
+			(SELECT COUNT(*) FROM reviews r WHERE r.book_id = books.id), version, deleted_at
+		FROM books
+		WHERE deleted_at IS NOT NULL
+		AND (title ILIKE '%%' || $1 || '%%' OR $1 = '')
+		ORDER BY %s, id ASC
+		LIMIT $2 OFFSET $3`, orderBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, title, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	books := []*DeletedBook{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var book DeletedBook
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.Title,
+			&book.ISBN,
+			&book.PublicationDate,
+			&book.Genre,
+			&book.Description,
+			&book.AverageRating,
+			&book.ReviewCount,
+			&book.Version,
+			&book.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return books, metadata, nil
+}
+
+// Restore takes a book out of the trash, in a revision made by the user
+func (m *BookModel) Restore(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, _, err := bookSnapshot(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE books
+		SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id
+		`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = recordBookRevision(ctx, tx, id, &userID, RevisionRestore, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Purge permanently deletes the books that were in the trash for longer
+// than the retention period, along with their reviews, reading list
+// entries and other related rows. It returns the IDs of the purged books.
+func (m *BookModel) Purge(retention time.Duration) ([]int64, error) {
+	query := `
+		DELETE FROM books
+		WHERE deleted_at < NOW() - make_interval(secs => $1)
+		RETURNING id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
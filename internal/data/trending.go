@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgie5/Test3-bookclubapi/internal/validator"
+)
+
+// Trending windows in days, as precomputed by the book_trends view
+var TrendingWindows = map[string]int{"7d": 7, "30d": 30, "365d": 365}
+
+// Trending metrics and the book_trends column each one ranks by
+var trendingMetrics = map[string]string{
+	"added":    "t.added",
+	"reviewed": "t.reviews",
+	"rated":    "t.rating",
+}
+
+// TrendingCriteria selects a leaderboard
+type TrendingCriteria struct {
+	Window     string
+	Metric     string // added, reviewed or rated
+	MinReviews int    // reviews a book needs in the window to be rated
+	Limit      int
+}
+
+// TrendingBook is a book on a leaderboard with its activity in the window
+type TrendingBook struct {
+	ID            int64    `json:"id"`
+	Title         string   `json:"title"`
+	AverageRating float64  `json:"average_rating"`
+	Added         int      `json:"added"`   // times added to a reading list
+	Reviews       int      `json:"reviews"` // reviews written
+	WindowRating  *float64 `json:"window_rating"`
+}
+
+// ValidateTrendingCriteria validates the leaderboard parameters
+func ValidateTrendingCriteria(v *validator.Validator, c TrendingCriteria) {
+	_, ok := TrendingWindows[c.Window]
+	v.Check(ok, "window", "must be one of 7d, 30d or 365d")
+	_, ok = trendingMetrics[c.Metric]
+	v.Check(ok, "metric", "must be one of added, reviewed or rated")
+	v.Check(c.MinReviews >= 1, "min_reviews", "must be at least 1")
+	v.Check(c.MinReviews <= 1000, "min_reviews", "must not be more than 1000")
+	v.Check(c.Limit > 0 && c.Limit <= 100, "limit", "must be between 1 and 100")
+}
+
+// Trending returns a leaderboard along with the time its figures were
+// computed, which is zero before the view was first refreshed with data
+func (m BookModel) Trending(c TrendingCriteria) ([]*TrendingBook, time.Time, error) {
+	column, ok := trendingMetrics[c.Metric]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("unknown trending metric: %q", c.Metric)
+	}
+
+	// the rating leaderboard only counts books with enough reviews
+	query := fmt.Sprintf(`
+		SELECT b.id, b.title, COALESCE(b.average_rating, 0), t.added, t.reviews, t.rating, t.refreshed_at
+		FROM book_trends t
+		JOIN books b ON b.id = t.book_id AND b.deleted_at IS NULL
+		WHERE t.window_days = $1
+		AND %s > 0
+		AND ($2 <> 'rated' OR t.reviews >= $3)
+		ORDER BY %s DESC, t.reviews DESC, b.id ASC
+		LIMIT $4`, column, column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, TrendingWindows[c.Window], c.Metric, c.MinReviews, c.Limit)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	var refreshedAt time.Time
+	books := []*TrendingBook{}
+	for rows.Next() {
+		var book TrendingBook
+		err := rows.Scan(&book.ID, &book.Title, &book.AverageRating, &book.Added, &book.Reviews, &book.WindowRating, &refreshedAt)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return books, refreshedAt, nil
+}
+
+// RefreshTrending recomputes the book_trends view without blocking the
+// leaderboards while it runs
+func (m BookModel) RefreshTrending(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY book_trends`)
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/georgie5/Test3-bookclubapi/internal/validator"
@@ -240,13 +241,20 @@ func (u UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 }
 
 // /api/v1/users/{id}         # Get user profile
-func (u UserModel) GetUser(id int64) (*User, error) {
-	// the SQL query to be executed against the database table
-	query := `
-		SELECT id, created_at, username, email, activated
+func (u UserModel) GetUser(id int64, fields []string) (*User, error) {
+	// the SQL query to be executed against the database table, reading
+	// only the fields asked for
+	columns := []fieldColumn{
+		{"id", "id", "id"},
+		{"created_at", "created_at", "'0001-01-01'::timestamptz"},
+		{"username", "username", "''"},
+		{"email", "email", "''"},
+		{"activated", "activated", "false"},
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM users
-		WHERE id = $1
-	`
+		WHERE id = $1`, selectFields(columns, fields))
 	// Create a context with a 3-second timeout. No database
 	// operation should take more than 3 seconds or we will quit it
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -264,10 +272,11 @@ func (u UserModel) GetUser(id int64) (*User, error) {
 }
 
 // GET    /api/v1/users/{id}/lists   # Get user's reading lists
-func (u UserModel) GetLists(id int64) ([]*ReadingList, error) {
+// Only the fields in the fieldset are read, all of them when it is empty.
+func (u UserModel) GetLists(id int64, fields []string) ([]*ReadingList, error) {
 	// the SQL query to be executed against the database table
 	query := `
-		SELECT id, name, description, status, created_by, version
+		SELECT ` + selectFields(readingListColumns, fields) + `
 		FROM reading_lists
 		WHERE created_by = $1
 	`
@@ -289,7 +298,7 @@ func (u UserModel) GetLists(id int64) ([]*ReadingList, error) {
 	for rows.Next() {
 		list := &ReadingList{}
 		// Scan the current row into the List struct
-		err := rows.Scan(&list.ID, &list.Name, &list.Description, &list.Status, &list.CreatedBy, &list.Version)
+		err := rows.Scan(&list.ID, &list.Name, &list.Description, &list.CreatedBy, &list.Status, &list.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -306,12 +315,14 @@ func (u UserModel) GetLists(id int64) ([]*ReadingList, error) {
 }
 
 // GET    /api/v1/users/{id}/reviews # Get user's reviews
-func (u UserModel) GetReviews(id int64) ([]*Review, error) {
+// Only the fields in the fieldset are read, all of them when it is empty.
+func (u UserModel) GetReviews(id int64, fields []string) ([]*Review, error) {
 	// the SQL query to be executed against the database table
 	query := `
-		SELECT id, review_date, book_id, rating, review
+		SELECT ` + selectFields(reviewColumns, fields) + `
 		FROM reviews
 		WHERE user_id = $1
+		AND EXISTS (SELECT 1 FROM books b WHERE b.id = reviews.book_id AND b.deleted_at IS NULL)
 	`
 	// Create a context with a 3-second timeout. No database
 	// operation should take more than 3 seconds or we will quit it
@@ -331,7 +342,7 @@ func (u UserModel) GetReviews(id int64) ([]*Review, error) {
 	for rows.Next() {
 		review := &Review{}
 		// Scan the current row into the Review struct
-		err := rows.Scan(&review.ID, &review.ReviewDate, &review.BookID, &review.Rating, &review.Review)
+		err := rows.Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.Review, &review.ReviewDate, &review.Version)
 		if err != nil {
 			return nil, err
 		}
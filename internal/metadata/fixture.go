@@ -0,0 +1,83 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fixtureRecord is one book in a fixture file. Cover files are relative
+// to the directory of the fixture file.
+type fixtureRecord struct {
+	ISBN            string   `json:"isbn"`
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	Description     string   `json:"description"`
+	PublicationDate string   `json:"publication_date"`
+	CoverFile       string   `json:"cover_file"`
+}
+
+// Fixture serves metadata from a JSON file, so enrichment can be used and
+// tested without a network connection
+type Fixture struct {
+	books map[string]*Book
+}
+
+// NewFixture loads a fixture file holding an array of books
+func NewFixture(path string) (*Fixture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []fixtureRecord
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&records)
+	if err != nil {
+		return nil, fmt.Errorf("reading metadata fixtures %s: %w", path, err)
+	}
+
+	f := &Fixture{books: make(map[string]*Book, len(records))}
+	for _, record := range records {
+		book := &Book{
+			ISBN:            NormalizeISBN(record.ISBN),
+			Title:           record.Title,
+			Authors:         record.Authors,
+			Description:     record.Description,
+			PublicationDate: ParseDate(record.PublicationDate),
+		}
+		if record.CoverFile != "" {
+			book.Cover = filepath.Join(filepath.Dir(path), record.CoverFile)
+		}
+		f.books[book.ISBN] = book
+	}
+
+	return f, nil
+}
+
+func (f *Fixture) Name() string {
+	return "fixture"
+}
+
+func (f *Fixture) Lookup(ctx context.Context, isbn string) (*Book, error) {
+	book, ok := f.books[NormalizeISBN(isbn)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	// hand out a copy so callers can not change the fixtures
+	found := *book
+	found.Authors = append([]string(nil), book.Authors...)
+	return &found, nil
+}
+
+func (f *Fixture) OpenCover(ctx context.Context, book *Book) (io.ReadCloser, error) {
+	if book.Cover == "" {
+		return nil, ErrNotFound
+	}
+	return os.Open(book.Cover)
+}
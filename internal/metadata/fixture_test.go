@@ -0,0 +1,161 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const fixturePath = "../../testdata/metadata/books.json"
+
+func TestFixtureLookup(t *testing.T) {
+	fixture, err := NewFixture(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		isbn string
+		want *Book
+	}{
+		{
+			name: "hyphenated ISBN in the file",
+			isbn: "9780060853983",
+			want: &Book{
+				ISBN:            "9780060853983",
+				Title:           "Good Omens",
+				Authors:         []string{"Neil Gaiman", "Terry Pratchett"},
+				Description:     "According to The Nice and Accurate Prophecies of Agnes Nutter, Witch, the world will end on a Saturday. Next Saturday, in fact.",
+				PublicationDate: "1990-05-01",
+				Cover:           filepath.Join("../../testdata/metadata", "covers/9780060853983.png"),
+			},
+		},
+		{
+			name: "hyphenated ISBN in the lookup",
+			isbn: "978-0-441-17271-9",
+			want: &Book{
+				ISBN:            "9780441172719",
+				Title:           "Dune",
+				Authors:         []string{"Frank Herbert"},
+				Description:     "Set on the desert planet Arrakis, Dune is the story of the boy Paul Atreides, heir to a noble family tasked with ruling an inhospitable world.",
+				PublicationDate: "1965-08-01",
+			},
+		},
+		{
+			name: "year only",
+			isbn: "9780141439518",
+			want: &Book{
+				ISBN:            "9780141439518",
+				Title:           "Pride and Prejudice",
+				Authors:         []string{"Jane Austen"},
+				Description:     "It is a truth universally acknowledged, that a single man in possession of a good fortune, must be in want of a wife.",
+				PublicationDate: "1813-01-01",
+			},
+		},
+		{
+			name: "unknown ISBN",
+			isbn: "9780000000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fixture.Lookup(context.Background(), tt.isbn)
+			if tt.want == nil {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("got error %v, want ErrNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixtureLookupReturnsCopies(t *testing.T) {
+	fixture, err := NewFixture(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := fixture.Lookup(context.Background(), "9780441172719")
+	if err != nil {
+		t.Fatal(err)
+	}
+	book.Title = "changed"
+	book.Authors[0] = "changed"
+
+	again, err := fixture.Lookup(context.Background(), "9780441172719")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Title != "Dune" || again.Authors[0] != "Frank Herbert" {
+		t.Errorf("the fixture was changed through a lookup: %+v", again)
+	}
+}
+
+func TestFixtureOpenCover(t *testing.T) {
+	fixture, err := NewFixture(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := fixture.Lookup(context.Background(), "9780060853983")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cover, err := fixture.OpenCover(context.Background(), book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cover.Close()
+
+	book, err = fixture.Lookup(context.Background(), "9780441172719")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fixture.OpenCover(context.Background(), book)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v, want ErrNotFound for a book without a cover", err)
+	}
+}
+
+func TestNewFixtureErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"not json", "isbn,title"},
+		{"not an array", `{"isbn": "9780441172719"}`},
+		{"unknown field", `[{"isbn": "9780441172719", "price": 10}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "books.json")
+			err := os.WriteFile(path, []byte(tt.content), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = NewFixture(path)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	_, err := NewFixture(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
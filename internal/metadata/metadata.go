@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("no metadata found")
+
+// Book is what a provider knows about an edition
+type Book struct {
+	ISBN            string   `json:"isbn"`
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	Description     string   `json:"description"`
+	PublicationDate string   `json:"publication_date"` // YYYY-MM-DD, or empty when unknown
+	CoverURL        string   `json:"cover_url,omitempty"`
+	// a provider specific reference to the cover, passed back to OpenCover
+	Cover string `json:"-"`
+}
+
+// Provider looks up book metadata by ISBN. Lookup and OpenCover return
+// ErrNotFound when the provider has nothing for the book.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn string) (*Book, error)
+	OpenCover(ctx context.Context, book *Book) (io.ReadCloser, error)
+}
+
+// NormalizeISBN strips the hyphens and spaces from an ISBN
+func NormalizeISBN(isbn string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(isbn) {
+		if (r >= '0' && r <= '9') || r == 'X' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// the ways publication dates are written by the providers, most precise first
+var dateLayouts = []string{
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2006-01",
+	"January 2006",
+	"Jan 2006",
+	"2006",
+}
+
+// ParseDate turns a publication date in one of the common formats into
+// YYYY-MM-DD, using the first of the month or year when only those are
+// known. It returns "" if the date can not be parsed.
+func ParseDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date.Format("2006-01-02")
+		}
+	}
+	return ""
+}
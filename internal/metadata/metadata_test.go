@@ -0,0 +1,47 @@
+package metadata
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want string
+	}{
+		{"9780441172719", "9780441172719"},
+		{"978-0-06-085398-3", "9780060853983"},
+		{" 978 0 06 085398 3 ", "9780060853983"},
+		{"0-8044-2957-x", "080442957X"},
+		{"ISBN 0-8044-2957-X", "080442957X"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeISBN(tt.isbn); got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q, want %q", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"1965-08-01", "1965-08-01"},
+		{"August 1, 1965", "1965-08-01"},
+		{"Aug 1, 1965", "1965-08-01"},
+		{"1 August 1965", "1965-08-01"},
+		{"1965-08", "1965-08-01"},
+		{"August 1965", "1965-08-01"},
+		{"Aug 1965", "1965-08-01"},
+		{" 1965 ", "1965-01-01"},
+		{"circa 1965", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ParseDate(tt.value); got != tt.want {
+			t.Errorf("ParseDate(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
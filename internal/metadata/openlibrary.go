@@ -0,0 +1,137 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const openLibraryURL = "https://openlibrary.org"
+
+// OpenLibrary looks books up with the Open Library books API,
+// see https://openlibrary.org/dev/docs/api/books
+type OpenLibrary struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewOpenLibrary() *OpenLibrary {
+	return &OpenLibrary{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		baseURL: openLibraryURL,
+	}
+}
+
+// the parts of a jscmd=details response we use
+type openLibraryDetails struct {
+	Details struct {
+		Title       string          `json:"title"`
+		Description json.RawMessage `json:"description"`
+		PublishDate string          `json:"publish_date"`
+		Authors     []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+		Covers []int64 `json:"covers"`
+	} `json:"details"`
+}
+
+func (o *OpenLibrary) Name() string {
+	return "openlibrary"
+}
+
+func (o *OpenLibrary) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "bookclub-api (metadata enrichment)")
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	default:
+		res.Body.Close()
+		return nil, fmt.Errorf("open library: unexpected status %s", res.Status)
+	}
+}
+
+func (o *OpenLibrary) Lookup(ctx context.Context, isbn string) (*Book, error) {
+	isbn = NormalizeISBN(isbn)
+	key := "ISBN:" + isbn
+
+	query := url.Values{"bibkeys": {key}, "format": {"json"}, "jscmd": {"details"}}
+	res, err := o.get(ctx, o.baseURL+"/api/books?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// unknown ISBNs are simply missing from the response
+	var found map[string]openLibraryDetails
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&found)
+	if err != nil {
+		return nil, fmt.Errorf("open library: %w", err)
+	}
+	details, ok := found[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	book := &Book{
+		ISBN:            isbn,
+		Title:           details.Details.Title,
+		Description:     openLibraryText(details.Details.Description),
+		PublicationDate: ParseDate(details.Details.PublishDate),
+	}
+	for _, author := range details.Details.Authors {
+		if author.Name != "" {
+			book.Authors = append(book.Authors, author.Name)
+		}
+	}
+	// -1 marks a missing cover in the Open Library data
+	if len(details.Details.Covers) > 0 && details.Details.Covers[0] > 0 {
+		book.CoverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-L.jpg", details.Details.Covers[0])
+		book.Cover = book.CoverURL
+	}
+
+	return book, nil
+}
+
+// openLibraryText reads a text field, which is either a plain string or
+// a {"type": "/type/text", "value": "..."} object
+func openLibraryText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if json.Unmarshal(raw, &typed) == nil {
+		return typed.Value
+	}
+	return ""
+}
+
+func (o *OpenLibrary) OpenCover(ctx context.Context, book *Book) (io.ReadCloser, error) {
+	if book.Cover == "" {
+		return nil, ErrNotFound
+	}
+	res, err := o.get(ctx, book.Cover)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
@@ -0,0 +1,136 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newTestOpenLibrary serves the responses by the bibkeys they ask for
+func newTestOpenLibrary(t *testing.T, status int, body string) *OpenLibrary {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/books" || r.URL.Query().Get("jscmd") != "details" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return &OpenLibrary{client: server.Client(), baseURL: server.URL}
+}
+
+func TestOpenLibraryLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    *Book
+		wantErr error
+	}{
+		{
+			name:   "plain description",
+			status: http.StatusOK,
+			body: `{"ISBN:9780441172719": {"details": {
+				"title": "Dune",
+				"description": "Spice.",
+				"publish_date": "August 1, 1965",
+				"authors": [{"name": "Frank Herbert"}, {"name": ""}],
+				"covers": [12345]
+			}}}`,
+			want: &Book{
+				ISBN:            "9780441172719",
+				Title:           "Dune",
+				Authors:         []string{"Frank Herbert"},
+				Description:     "Spice.",
+				PublicationDate: "1965-08-01",
+				CoverURL:        "https://covers.openlibrary.org/b/id/12345-L.jpg",
+				Cover:           "https://covers.openlibrary.org/b/id/12345-L.jpg",
+			},
+		},
+		{
+			name:   "typed description and missing cover",
+			status: http.StatusOK,
+			body: `{"ISBN:9780441172719": {"details": {
+				"title": "Dune",
+				"description": {"type": "/type/text", "value": "Spice."},
+				"publish_date": "1965",
+				"covers": [-1]
+			}}}`,
+			want: &Book{
+				ISBN:            "9780441172719",
+				Title:           "Dune",
+				Description:     "Spice.",
+				PublicationDate: "1965-01-01",
+			},
+		},
+		{
+			name:   "unparsable date",
+			status: http.StatusOK,
+			body:   `{"ISBN:9780441172719": {"details": {"title": "Dune", "publish_date": "sometime"}}}`,
+			want: &Book{
+				ISBN:  "9780441172719",
+				Title: "Dune",
+			},
+		},
+		{
+			name:    "unknown ISBN",
+			status:  http.StatusOK,
+			body:    `{}`,
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "not found",
+			status:  http.StatusNotFound,
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openLibrary := newTestOpenLibrary(t, tt.status, tt.body)
+
+			got, err := openLibrary.Lookup(context.Background(), "978-0-441-17271-9")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenLibraryLookupErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"server error", http.StatusInternalServerError, ""},
+		{"malformed response", http.StatusOK, `{"ISBN:9780441172719": `},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openLibrary := newTestOpenLibrary(t, tt.status, tt.body)
+
+			_, err := openLibrary.Lookup(context.Background(), "9780441172719")
+			if err == nil || errors.Is(err, ErrNotFound) {
+				t.Errorf("got error %v, want a failure", err)
+			}
+		})
+	}
+}
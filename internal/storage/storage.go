@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage keeps uploaded files under slash-separated keys such as
+// "covers/42/1/original". Put replaces any object stored under the key.
+type Storage interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (Object, error)
+	Delete(prefix string) error
+}
+
+// Object is a stored file opened for reading
+type Object interface {
+	io.ReadSeekCloser
+	ModTime() time.Time
+}
+
+// Local stores the objects as files below a directory on the local disk
+type Local struct {
+	root string
+}
+
+// NewLocal returns a Local storage rooted at dir, creating it if needed
+func NewLocal(dir string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{root: dir}, nil
+}
+
+// path maps a key to a file below the root, keys can not escape it
+func (s *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "\\") {
+		return "", errors.New("invalid storage key")
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the object to a temporary file first and renames it into
+// place, so readers never see a half written file
+func (s *Local) Put(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+type localObject struct {
+	*os.File
+	modTime time.Time
+}
+
+func (o localObject) ModTime() time.Time {
+	return o.modTime
+}
+
+// Open opens the object stored under the key
+func (s *Local) Open(key string) (Object, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+
+	return localObject{File: file, modTime: info.ModTime()}, nil
+}
+
+// Delete removes every object whose key starts with the prefix followed by
+// a slash, as well as the object named by the prefix itself
+func (s *Local) Delete(prefix string) error {
+	path, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
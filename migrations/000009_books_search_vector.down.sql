@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_books_search_vector;
+DROP TRIGGER IF EXISTS authors_search_vector_trigger ON authors;
+DROP TRIGGER IF EXISTS book_authors_search_vector_trigger ON book_authors;
+DROP TRIGGER IF EXISTS books_search_vector_trigger ON books;
+DROP FUNCTION IF EXISTS authors_search_vector_update();
+DROP FUNCTION IF EXISTS book_authors_search_vector_update();
+DROP FUNCTION IF EXISTS books_search_vector_update();
+ALTER TABLE books DROP COLUMN IF EXISTS search_vector;
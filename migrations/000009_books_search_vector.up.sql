@@ -0,0 +1,56 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+-- Title carries the most weight, then the author names, then the description.
+CREATE OR REPLACE FUNCTION books_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce((
+            SELECT string_agg(a.name, ' ')
+            FROM book_authors ba
+            JOIN authors a ON a.id = ba.author_id
+            WHERE ba.book_id = NEW.id
+        ), '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, description, search_vector ON books
+    FOR EACH ROW EXECUTE FUNCTION books_search_vector_update();
+
+-- Touching search_vector fires the trigger above so the author names are
+-- picked up whenever a book's authors change.
+CREATE OR REPLACE FUNCTION book_authors_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE books SET search_vector = NULL WHERE id = NEW.book_id;
+    END IF;
+    IF TG_OP IN ('DELETE', 'UPDATE') THEN
+        UPDATE books SET search_vector = NULL WHERE id = OLD.book_id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER book_authors_search_vector_trigger
+    AFTER INSERT OR UPDATE OR DELETE ON book_authors
+    FOR EACH ROW EXECUTE FUNCTION book_authors_search_vector_update();
+
+CREATE OR REPLACE FUNCTION authors_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    UPDATE books SET search_vector = NULL
+    WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = NEW.id);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER authors_search_vector_trigger
+    AFTER UPDATE OF name ON authors
+    FOR EACH ROW EXECUTE FUNCTION authors_search_vector_update();
+
+-- Backfill the existing catalogue.
+UPDATE books SET search_vector = NULL;
+
+CREATE INDEX IF NOT EXISTS idx_books_search_vector ON books USING GIN (search_vector);
@@ -0,0 +1,94 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    parent_id bigint REFERENCES genres(id) ON DELETE SET NULL,
+    version integer NOT NULL DEFAULT 1,
+    CHECK (parent_id <> id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_genres_parent_id ON genres(parent_id);
+
+CREATE TABLE IF NOT EXISTS book_genres (
+    book_id INT REFERENCES books(id) ON DELETE CASCADE,
+    genre_id bigint REFERENCES genres(id) ON DELETE CASCADE,
+    PRIMARY KEY (book_id, genre_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_genres_genre_id ON book_genres(genre_id);
+
+-- Seed a starting taxonomy
+INSERT INTO genres (name, slug) VALUES
+    ('Fiction', 'fiction'),
+    ('Non-Fiction', 'non-fiction')
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO genres (name, slug, parent_id)
+SELECT v.name, v.slug, p.id
+FROM (VALUES
+    ('Fantasy', 'fantasy', 'fiction'),
+    ('Science Fiction', 'science-fiction', 'fiction'),
+    ('Mystery', 'mystery', 'fiction'),
+    ('Thriller', 'thriller', 'fiction'),
+    ('Romance', 'romance', 'fiction'),
+    ('Horror', 'horror', 'fiction'),
+    ('Historical Fiction', 'historical-fiction', 'fiction'),
+    ('Literary Fiction', 'literary-fiction', 'fiction'),
+    ('Young Adult', 'young-adult', 'fiction'),
+    ('Biography', 'biography', 'non-fiction'),
+    ('History', 'history', 'non-fiction'),
+    ('Science', 'science', 'non-fiction'),
+    ('Self-Help', 'self-help', 'non-fiction'),
+    ('Poetry', 'poetry', NULL)
+) AS v(name, slug, parent_slug)
+LEFT JOIN genres p ON p.slug = v.parent_slug
+ON CONFLICT (slug) DO NOTHING;
+
+-- Migrate the free-text genres. Values are matched on their slug, so
+-- differences in case and punctuation collapse into one genre, and a few
+-- common abbreviations are folded into the seeded genres. Letters and
+-- digits of any script are kept in the slug.
+CREATE TEMPORARY TABLE book_genre_slugs AS
+SELECT b.id AS book_id, trim(b.genre) AS name,
+    CASE s.slug
+        WHEN 'sci-fi' THEN 'science-fiction'
+        WHEN 'scifi' THEN 'science-fiction'
+        WHEN 'sf' THEN 'science-fiction'
+        WHEN 'nonfiction' THEN 'non-fiction'
+        WHEN 'ya' THEN 'young-adult'
+        ELSE s.slug
+    END AS slug
+FROM books b
+CROSS JOIN LATERAL (
+    SELECT trim(BOTH '-' FROM regexp_replace(lower(b.genre), '[^[:alnum:]]+', '-', 'g')) AS slug
+) s
+WHERE s.slug <> '';
+
+-- New genres are named after their most common spelling
+INSERT INTO genres (name, slug)
+SELECT name, slug
+FROM (
+    SELECT DISTINCT ON (slug) name, slug, uses
+    FROM (
+        SELECT name, slug, COUNT(*) AS uses
+        FROM book_genre_slugs
+        GROUP BY name, slug
+    ) spellings
+    ORDER BY slug, uses DESC, name
+) canonical
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO book_genres (book_id, genre_id)
+SELECT s.book_id, g.id
+FROM book_genre_slugs s
+JOIN genres g ON g.slug = s.slug
+ON CONFLICT DO NOTHING;
+
+-- books.genre keeps the canonical name of the primary genre
+UPDATE books b
+SET genre = g.name
+FROM book_genre_slugs s
+JOIN genres g ON g.slug = s.slug
+WHERE b.id = s.book_id;
+
+DROP TABLE book_genre_slugs;
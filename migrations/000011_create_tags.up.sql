@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+-- Tags are applied per user, so the same tag on a book counts once per member
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id INT REFERENCES books(id) ON DELETE CASCADE,
+    tag_id bigint REFERENCES tags(id) ON DELETE CASCADE,
+    user_id INT REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (book_id, tag_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_tags_tag_id ON book_tags(tag_id);
+CREATE INDEX IF NOT EXISTS idx_book_tags_user_id ON book_tags(user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    format TEXT NOT NULL CHECK (format IN ('csv', 'jsonl')),
+    dry_run bool NOT NULL DEFAULT false,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    report jsonb,
+    error TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_user_id ON import_jobs(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE books
+    DROP COLUMN IF EXISTS cover_updated_at,
+    DROP COLUMN IF EXISTS cover_content_type;
@@ -0,0 +1,5 @@
+-- the cover images themselves live in the file storage, the books only
+-- record the type of the uploaded original and when it was last replaced
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS cover_content_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cover_updated_at timestamp(0) WITH TIME ZONE;
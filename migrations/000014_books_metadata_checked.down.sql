@@ -0,0 +1 @@
+ALTER TABLE books DROP COLUMN IF EXISTS metadata_checked_at;
@@ -0,0 +1,3 @@
+-- when the metadata backfill last looked the book up, so books a provider
+-- knows nothing about are not looked up on every run
+ALTER TABLE books ADD COLUMN IF NOT EXISTS metadata_checked_at timestamp(0) WITH TIME ZONE;
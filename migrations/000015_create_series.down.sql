@@ -0,0 +1,32 @@
+DROP TRIGGER IF EXISTS series_search_vector_trigger ON series;
+DROP FUNCTION IF EXISTS series_search_vector_update();
+
+CREATE OR REPLACE FUNCTION books_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce((
+            SELECT string_agg(a.name, ' ')
+            FROM book_authors ba
+            JOIN authors a ON a.id = ba.author_id
+            WHERE ba.book_id = NEW.id
+        ), '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS books_search_vector_trigger ON books;
+CREATE TRIGGER books_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, description, search_vector ON books
+    FOR EACH ROW EXECUTE FUNCTION books_search_vector_update();
+
+ALTER TABLE books
+    DROP CONSTRAINT IF EXISTS books_series_position_check,
+    DROP COLUMN IF EXISTS series_position,
+    DROP COLUMN IF EXISTS series_id;
+
+-- recompute the vectors of the books that were in a series
+UPDATE books SET search_vector = NULL;
+
+DROP TABLE IF EXISTS series;
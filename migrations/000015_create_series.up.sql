@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS series (
+    id bigserial PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+-- Positions are fractional so novellas can sit between two books (2.5).
+-- A book without a position is listed after the numbered ones.
+ALTER TABLE books
+    ADD COLUMN IF NOT EXISTS series_id bigint REFERENCES series,
+    ADD COLUMN IF NOT EXISTS series_position numeric(8, 3),
+    ADD CONSTRAINT books_series_position_check
+        CHECK (series_position IS NULL OR (series_id IS NOT NULL AND series_position >= 0));
+
+CREATE INDEX IF NOT EXISTS idx_books_series ON books(series_id, series_position);
+
+-- The series name is searchable along with the author names.
+CREATE OR REPLACE FUNCTION books_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce((
+            SELECT string_agg(a.name, ' ')
+            FROM book_authors ba
+            JOIN authors a ON a.id = ba.author_id
+            WHERE ba.book_id = NEW.id
+        ), '')), 'B') ||
+        setweight(to_tsvector('english', coalesce((
+            SELECT s.name FROM series s WHERE s.id = NEW.series_id
+        ), '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS books_search_vector_trigger ON books;
+CREATE TRIGGER books_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF title, description, series_id, search_vector ON books
+    FOR EACH ROW EXECUTE FUNCTION books_search_vector_update();
+
+CREATE OR REPLACE FUNCTION series_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    UPDATE books SET search_vector = NULL WHERE series_id = NEW.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER series_search_vector_trigger
+    AFTER UPDATE OF name ON series
+    FOR EACH ROW EXECUTE FUNCTION series_search_vector_update();
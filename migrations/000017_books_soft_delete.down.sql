@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_books_deleted_at;
+DELETE FROM books WHERE deleted_at IS NOT NULL;
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,5 @@
+-- Deleted books stay in the table until they are purged, so they can be
+-- restored along with their reviews and reading list entries.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,43 @@
+-- Every change to a book is kept as a revision with the full state of the
+-- book after the change (snapshot) and the fields that changed, each with
+-- its previous and new value (changes).
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id bigserial PRIMARY KEY,
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    book_version integer NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'update', 'revert')),
+    changes jsonb NOT NULL DEFAULT '{}',
+    snapshot jsonb NOT NULL,
+    reverted_from bigint REFERENCES book_revisions ON DELETE SET NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_revisions_book_id ON book_revisions(book_id, id);
+
+-- A starting revision for the books already in the catalogue, so they can
+-- be reverted to their current state. The snapshot must match the
+-- BookSnapshot type.
+INSERT INTO book_revisions (book_id, book_version, action, snapshot)
+SELECT b.id, b.version, 'create', jsonb_build_object(
+    'title', b.title,
+    'authors', COALESCE((
+        SELECT jsonb_agg(a.name ORDER BY a.name)
+        FROM book_authors ba
+        JOIN authors a ON a.id = ba.author_id
+        WHERE ba.book_id = b.id
+    ), '[]'::jsonb),
+    'isbn', COALESCE(b.isbn, ''),
+    'publication_date', COALESCE(to_char(b.publication_date, 'YYYY-MM-DD'), ''),
+    'genre', b.genre,
+    'genres', COALESCE((
+        SELECT jsonb_agg(g.name ORDER BY g.name = b.genre DESC, g.name)
+        FROM book_genres bg
+        JOIN genres g ON g.id = bg.genre_id
+        WHERE bg.book_id = b.id
+    ), '[]'::jsonb),
+    'description', b.description,
+    'series_id', b.series_id,
+    'series_position', b.series_position::float8
+)
+FROM books b;
@@ -0,0 +1,16 @@
+-- The books most similar to each book, recomputed periodically by the
+-- similar books job. The shared_* columns explain the score.
+CREATE TABLE IF NOT EXISTS book_similarities (
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    similar_book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    score real NOT NULL,
+    shared_authors integer NOT NULL DEFAULT 0,
+    shared_genres integer NOT NULL DEFAULT 0,
+    shared_tags integer NOT NULL DEFAULT 0,
+    shared_lists integer NOT NULL DEFAULT 0,
+    shared_reviewers integer NOT NULL DEFAULT 0,
+    computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (book_id, similar_book_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_similarities_score ON book_similarities(book_id, score DESC);
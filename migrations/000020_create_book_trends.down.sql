@@ -0,0 +1,4 @@
+DROP MATERIALIZED VIEW IF EXISTS book_trends;
+DROP INDEX IF EXISTS idx_reviews_review_date;
+DROP INDEX IF EXISTS idx_reading_lists_books_added_at;
+ALTER TABLE reading_lists_books DROP COLUMN IF EXISTS added_at;
@@ -0,0 +1,38 @@
+-- When a book was put on a list. It is unknown for the books already on a
+-- list, so those are left NULL and the trending job leaves them out; only
+-- books added from now on are stamped.
+ALTER TABLE reading_lists_books ADD COLUMN IF NOT EXISTS added_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE reading_lists_books ALTER COLUMN added_at SET DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_reading_lists_books_added_at ON reading_lists_books(added_at);
+CREATE INDEX IF NOT EXISTS idx_reviews_review_date ON reviews(review_date);
+
+-- How often each book was added to a reading list and reviewed over the
+-- last 7, 30 and 365 days, refreshed periodically by the trending job.
+-- Books with no activity in a window are left out of it.
+CREATE MATERIALIZED VIEW IF NOT EXISTS book_trends AS
+WITH windows (days) AS (VALUES (7), (30), (365)),
+added AS (
+    SELECT w.days, rlb.book_id, COUNT(*) AS added
+    FROM windows w
+    JOIN reading_lists_books rlb ON rlb.added_at >= NOW() - make_interval(days => w.days)
+    GROUP BY w.days, rlb.book_id
+),
+reviewed AS (
+    SELECT w.days, r.book_id, COUNT(*) AS reviews, AVG(r.rating) AS rating
+    FROM windows w
+    JOIN reviews r ON r.review_date >= NOW() - make_interval(days => w.days)
+    GROUP BY w.days, r.book_id
+)
+SELECT COALESCE(a.days, r.days) AS window_days,
+    COALESCE(a.book_id, r.book_id) AS book_id,
+    COALESCE(a.added, 0) AS added,
+    COALESCE(r.reviews, 0) AS reviews,
+    r.rating,
+    NOW() AS refreshed_at
+FROM added a
+FULL JOIN reviewed r ON r.days = a.days AND r.book_id = a.book_id
+WHERE COALESCE(a.book_id, r.book_id) IS NOT NULL;
+
+-- Needed to refresh the view concurrently
+CREATE UNIQUE INDEX IF NOT EXISTS idx_book_trends_window_book ON book_trends(window_days, book_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_series_name_trgm;
+DROP INDEX IF EXISTS idx_authors_name_trgm;
+DROP INDEX IF EXISTS idx_books_title_trgm;
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,6 @@
+-- Trigram indexes for the typo tolerant search and the suggestions
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_books_title_trgm ON books USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_authors_name_trgm ON authors USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_series_name_trgm ON series USING GIN (name gin_trgm_ops);
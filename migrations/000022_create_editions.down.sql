@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS books_primary_edition_trigger ON books;
+DROP FUNCTION IF EXISTS books_primary_edition_sync();
+DROP TABLE IF EXISTS editions;
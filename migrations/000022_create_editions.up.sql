@@ -0,0 +1,51 @@
+-- The books table holds the works. A work is published in editions, each
+-- with its own ISBN. Audiobooks have a duration instead of a page count.
+CREATE TABLE IF NOT EXISTS editions (
+    id bigserial PRIMARY KEY,
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    isbn TEXT UNIQUE,
+    format TEXT CHECK (format IN ('hardcover', 'paperback', 'ebook', 'audiobook')),
+    page_count integer CHECK (page_count > 0),
+    duration_minutes integer CHECK (duration_minutes > 0),
+    publisher TEXT NOT NULL DEFAULT '',
+    language TEXT NOT NULL DEFAULT '',
+    publication_date DATE,
+    is_primary boolean NOT NULL DEFAULT false,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT editions_length_check CHECK (
+        (format = 'audiobook' AND page_count IS NULL) OR
+        (format IS DISTINCT FROM 'audiobook' AND duration_minutes IS NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_editions_book_id ON editions(book_id);
+
+-- The primary edition is the one the books API shows, its ISBN and
+-- publication date are copies of the ones on the work.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_editions_primary ON editions(book_id) WHERE is_primary;
+
+INSERT INTO editions (book_id, isbn, publication_date, is_primary)
+SELECT id, NULLIF(isbn, ''), publication_date, true
+FROM books;
+
+-- Books created or changed through the books API keep their primary
+-- edition in step.
+CREATE OR REPLACE FUNCTION books_primary_edition_sync() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO editions (book_id, isbn, publication_date, is_primary)
+        VALUES (NEW.id, NULLIF(NEW.isbn, ''), NEW.publication_date, true);
+    ELSE
+        UPDATE editions
+        SET isbn = NULLIF(NEW.isbn, ''), publication_date = NEW.publication_date, version = version + 1
+        WHERE book_id = NEW.id AND is_primary
+        AND (isbn IS DISTINCT FROM NULLIF(NEW.isbn, '') OR publication_date IS DISTINCT FROM NEW.publication_date);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER books_primary_edition_trigger
+    AFTER INSERT OR UPDATE OF isbn, publication_date ON books
+    FOR EACH ROW EXECUTE FUNCTION books_primary_edition_sync();
@@ -0,0 +1 @@
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_book_user_key;
@@ -0,0 +1,12 @@
+-- Keep only the latest review of each user for each book
+DELETE FROM reviews r
+USING reviews newer
+WHERE newer.book_id = r.book_id
+    AND newer.user_id = r.user_id
+    AND (newer.review_date, newer.id) > (r.review_date, r.id);
+
+-- The removed duplicates counted towards the average ratings
+UPDATE books b
+SET average_rating = COALESCE((SELECT AVG(rating) FROM reviews WHERE book_id = b.id), 0);
+
+ALTER TABLE reviews ADD CONSTRAINT reviews_book_user_key UNIQUE (book_id, user_id);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS reviews_rating_trigger ON reviews;
+DROP FUNCTION IF EXISTS reviews_rating_update();
+DROP FUNCTION IF EXISTS books_add_rating(BIGINT, INTEGER, INTEGER);
+ALTER TABLE books DROP COLUMN IF EXISTS rating_sum;
+ALTER TABLE books DROP COLUMN IF EXISTS rating_count;
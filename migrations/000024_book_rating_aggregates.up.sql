@@ -0,0 +1,46 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS rating_sum BIGINT NOT NULL DEFAULT 0;
+
+UPDATE books b
+SET rating_count = r.count,
+    rating_sum = r.sum,
+    average_rating = CASE WHEN r.count > 0 THEN r.sum::real / r.count ELSE 0 END
+FROM (
+    SELECT b.id, COUNT(rv.rating) AS count, COALESCE(SUM(rv.rating), 0) AS sum
+    FROM books b
+    LEFT JOIN reviews rv ON rv.book_id = b.id
+    GROUP BY b.id
+) r
+WHERE r.id = b.id;
+
+-- Adds a change in ratings to a book's count, sum and average
+CREATE OR REPLACE FUNCTION books_add_rating(book BIGINT, count_delta INTEGER, sum_delta INTEGER) RETURNS void AS $$
+    UPDATE books
+    SET rating_count = rating_count + count_delta,
+        rating_sum = rating_sum + sum_delta,
+        average_rating = CASE WHEN rating_count + count_delta > 0
+            THEN (rating_sum + sum_delta)::real / (rating_count + count_delta) ELSE 0 END
+    WHERE id = book;
+$$ LANGUAGE sql;
+
+-- Runs in the transaction of the review write, so the aggregates can not
+-- drift from the reviews. Reviews without a rating are not counted.
+CREATE OR REPLACE FUNCTION reviews_rating_update() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.book_id IS NOT DISTINCT FROM OLD.book_id
+        AND NEW.rating IS NOT DISTINCT FROM OLD.rating THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP IN ('DELETE', 'UPDATE') AND OLD.rating IS NOT NULL THEN
+        PERFORM books_add_rating(OLD.book_id, -1, -OLD.rating);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.rating IS NOT NULL THEN
+        PERFORM books_add_rating(NEW.book_id, 1, NEW.rating);
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reviews_rating_trigger
+    AFTER INSERT OR UPDATE OF book_id, rating OR DELETE ON reviews
+    FOR EACH ROW EXECUTE FUNCTION reviews_rating_update();
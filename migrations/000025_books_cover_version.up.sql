@@ -0,0 +1,5 @@
+-- cover_updated_at only has second resolution, so two uploads within a
+-- second shared a cover URL. The version goes up with every upload.
+ALTER TABLE books ADD COLUMN IF NOT EXISTS cover_version INTEGER NOT NULL DEFAULT 0;
+
+UPDATE books SET cover_version = 1 WHERE cover_updated_at IS NOT NULL;
@@ -0,0 +1,12 @@
+-- When the similar books of each book were last scored. A book scored
+-- with nothing in common with the rest is not scored again on request.
+CREATE TABLE IF NOT EXISTS book_similarity_runs (
+    book_id bigint PRIMARY KEY REFERENCES books ON DELETE CASCADE,
+    computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO book_similarity_runs (book_id, computed_at)
+SELECT book_id, MAX(computed_at)
+FROM book_similarities
+GROUP BY book_id
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,11 @@
+-- How alike readers rate each pair of books (the adjusted cosine similarity
+-- of their ratings), recomputed periodically by the recommendations job.
+-- Only the closest books of each book are kept.
+CREATE TABLE IF NOT EXISTS book_rating_similarities (
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    similar_book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    similarity real NOT NULL,
+    readers integer NOT NULL,
+    computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (book_id, similar_book_id)
+);
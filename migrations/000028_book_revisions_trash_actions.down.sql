@@ -0,0 +1,6 @@
+DELETE FROM book_revisions WHERE action IN ('delete', 'restore');
+
+ALTER TABLE book_revisions DROP CONSTRAINT IF EXISTS book_revisions_action_check;
+
+ALTER TABLE book_revisions ADD CONSTRAINT book_revisions_action_check
+    CHECK (action IN ('create', 'update', 'revert'));
@@ -0,0 +1,6 @@
+-- Moving a book to the trash and taking it out again are recorded as
+-- revisions too
+ALTER TABLE book_revisions DROP CONSTRAINT IF EXISTS book_revisions_action_check;
+
+ALTER TABLE book_revisions ADD CONSTRAINT book_revisions_action_check
+    CHECK (action IN ('create', 'update', 'revert', 'delete', 'restore'));